@@ -20,11 +20,14 @@
 package convert
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	hcl "github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
@@ -40,8 +43,47 @@ var evalContext = &hcl.EvalContext{
 
 type Options struct {
 	Simplify bool
+
+	// BlockList writes the blocks of every body as an ordered block list (see BlockListKey),
+	// not only of bodies the nested label encoding cannot represent
+	BlockList bool
+
+	// Ordered writes every body as a list of attributes and blocks in source order,
+	// see OrderedAttribute and OrderedBlock
+	Ordered bool
+
+	// FlattenBlocks writes a block that is the only one with its type and labels as a plain
+	// object rather than a single-element array
+	FlattenBlocks bool
+
+	// Terraform writes the blocks Terraform nests in other blocks as Terraform's JSON syntax
+	// does, like a single lifecycle block as an object and provisioners as an ordered array
+	Terraform bool
+
+	// Spec, when set, types attribute values and checks block labels as the hcldec spec
+	// it was built from describes, see NewSpec
+	Spec *Spec
+}
+
+// OrderedAttribute is an attribute in the ordered JSON style
+type OrderedAttribute struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// OrderedBlock is a block in the ordered JSON style
+type OrderedBlock struct {
+	Type   string        `json:"type"`
+	Labels []string      `json:"labels"`
+	Body   []interface{} `json:"body"`
 }
 
+// BlockListKey holds the blocks of a body as an ordered list of
+// {"type": ..., "labels": [...], "body": {...}} entries. It is used for bodies the usual
+// nested label encoding cannot represent, e.g. blocks of the same type with and without
+// labels, or a block type that is also an attribute name.
+const BlockListKey = "__blocks"
+
 // Bytes takes the contents of an HCL file, as bytes, and converts
 // them into a JSON representation of the HCL file.
 func Bytes(bytes []byte, filename string, options Options) ([]byte, error) {
@@ -60,27 +102,69 @@ func Bytes(bytes []byte, filename string, options Options) ([]byte, error) {
 
 // File takes an HCL file and converts it to its JSON representation.
 func File(file *hcl.File, options Options) ([]byte, error) {
-	convertedFile, err := ConvertFile(file, options)
+	if options.Ordered {
+		return orderedFile(file, options)
+	}
+
+	convertedFile, err := ConvertFileOrdered(file, options)
 	if err != nil {
 		return nil, fmt.Errorf("convert file: %w", err)
 	}
 
-	jsonBytes, err := json.Marshal(convertedFile)
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, convertedFile); err != nil {
+		return nil, fmt.Errorf("marshal json: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// orderedFile converts an HCL file to the ordered JSON style
+func orderedFile(file *hcl.File, options Options) ([]byte, error) {
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("convert file body to body type")
+	}
+
+	c := converter{
+		bytes:   file.Bytes,
+		options: options,
+	}
+
+	out, err := c.convertBodyOrdered(body, "", options.Spec)
 	if err != nil {
+		return nil, fmt.Errorf("convert body: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, out); err != nil {
 		return nil, fmt.Errorf("marshal json: %w", err)
 	}
 
-	return jsonBytes, nil
+	return buf.Bytes(), nil
 }
 
-type jsonObj = map[string]interface{}
+type jsonObj = *Object
+
+// blockInstances holds the bodies of all blocks sharing a type and labels
+type blockInstances []interface{}
 
 type converter struct {
 	bytes   []byte
 	options Options
 }
 
-func ConvertFile(file *hcl.File, options Options) (jsonObj, error) {
+func ConvertFile(file *hcl.File, options Options) (map[string]interface{}, error) {
+	out, err := ConvertFileOrdered(file, options)
+	if err != nil {
+		return nil, err
+	}
+	return out.Map(), nil
+}
+
+// ConvertFileOrdered converts an HCL file like ConvertFile, keeping the keys of every object
+// in source order. Arrays are []interface{} values.
+func ConvertFileOrdered(file *hcl.File, options Options) (*Object, error) {
 	body, ok := file.Body.(*hclsyntax.Body)
 	if !ok {
 		return nil, fmt.Errorf("convert file body to body type")
@@ -91,34 +175,227 @@ func ConvertFile(file *hcl.File, options Options) (jsonObj, error) {
 		options: options,
 	}
 
-	out, err := c.ConvertBody(body)
+	out, err := c.convertBody(body, "", c.options.Spec)
 	if err != nil {
 		return nil, fmt.Errorf("convert body: %w", err)
 	}
 
+	return orderedValue(out).(*Object), nil
+}
+
+// Expression converts a single expression, parsed from src, to its JSON representation.
+func Expression(expr hclsyntax.Expression, src []byte, options Options) (interface{}, error) {
+	c := converter{
+		bytes:   src,
+		options: options,
+	}
+
+	return c.ConvertExpression(expr)
+}
+
+// ObjectKey converts the key expression of an object item, parsed from src, to its string form.
+func ObjectKey(keyExpr hclsyntax.Expression, src []byte) (string, error) {
+	c := converter{
+		bytes: src,
+	}
+
+	return c.convertKey(keyExpr)
+}
+
+func (c *converter) ConvertBody(body *hclsyntax.Body) (map[string]interface{}, error) {
+	out, err := c.convertBody(body, "", c.options.Spec)
+	if err != nil {
+		return nil, err
+	}
+	return out.Map(), nil
+}
+
+// convertBody converts the body of a blockType block, empty for the file body, whose
+// attributes and blocks spec describes, if it isn't nil
+func (c *converter) convertBody(body *hclsyntax.Body, blockType string, spec *Spec) (jsonObj, error) {
+	if err := checkBlockLabels(body, spec); err != nil {
+		return nil, err
+	}
+
+	out := NewObject()
+	useBlockList := c.options.BlockList || needsBlockList(body)
+
+	// Keys are added in source order: attributes where they are written, block types
+	// where their first block is written
+	for _, item := range sourceOrder(body) {
+		switch item := item.(type) {
+		case *hclsyntax.Attribute:
+			value, err := c.convertAttribute(item, blockType, spec)
+			if err != nil {
+				return nil, err
+			}
+			out.Set(item.Name, value)
+		case *hclsyntax.Block:
+			if useBlockList {
+				if _, exists := out.Get(BlockListKey); !exists {
+					blocks, err := c.convertBlockList(body.Blocks, spec)
+					if err != nil {
+						return nil, err
+					}
+					out.Set(BlockListKey, blocks)
+				}
+				continue
+			}
+			if c.terraformBlocks() && len(item.Labels) == 1 && isTerraformOrderedBlock(item.Type, blockType) {
+				if err := c.convertOrderedBlock(item, out); err != nil {
+					return nil, fmt.Errorf("convert block: %w", err)
+				}
+				continue
+			}
+			if err := c.convertBlock(item, out, spec); err != nil {
+				return nil, fmt.Errorf("convert block: %w", err)
+			}
+		}
+	}
+
+	if !useBlockList && (c.options.FlattenBlocks || c.terraformBlocks()) {
+		flattened := make(map[string]bool)
+		for _, block := range body.Blocks {
+			// Terraform JSON writes blocks like lifecycle or dynamic as objects
+			if !c.options.FlattenBlocks && !isTerraformObjectBlock(block.Type, blockType) {
+				continue
+			}
+			if value, exists := out.Get(block.Type); exists && !flattened[block.Type] {
+				out.Set(block.Type, flattenBlocks(value))
+				flattened[block.Type] = true
+			}
+		}
+	}
+
 	return out, nil
 }
 
-func (c *converter) ConvertBody(body *hclsyntax.Body) (jsonObj, error) {
-	out := make(jsonObj)
+// flattenBlocks unwraps the single-element block arrays below a block type key
+func flattenBlocks(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case blockInstances:
+		if len(typed) == 1 {
+			return typed[0]
+		}
+		return typed
+	case jsonObj:
+		// An object of labels
+		for _, key := range typed.Keys() {
+			label, _ := typed.Get(key)
+			typed.Set(key, flattenBlocks(label))
+		}
+		return typed
+	default:
+		return value
+	}
+}
 
+// sourceOrder returns the attributes and blocks of body in the order they are written
+func sourceOrder(body *hclsyntax.Body) []hclsyntax.Node {
+	items := make([]hclsyntax.Node, 0, len(body.Attributes)+len(body.Blocks))
+	for _, attr := range body.Attributes {
+		items = append(items, attr)
+	}
 	for _, block := range body.Blocks {
-		if err := c.convertBlock(block, out); err != nil {
-			return nil, fmt.Errorf("convert block: %w", err)
-		}
+		items = append(items, block)
 	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Range().Start.Byte < items[j].Range().Start.Byte
+	})
+	return items
+}
 
-	var err error
-	for key, value := range body.Attributes {
-		out[key], err = c.ConvertExpression(value.Expr)
-		if err != nil {
-			return nil, fmt.Errorf("convert expression: %w", err)
+// convertBodyOrdered converts the body of a blockType block to a list of attributes and
+// blocks in source order
+func (c *converter) convertBodyOrdered(body *hclsyntax.Body, blockType string, spec *Spec) ([]interface{}, error) {
+	if err := checkBlockLabels(body, spec); err != nil {
+		return nil, err
+	}
+
+	out := make([]interface{}, 0, len(body.Attributes)+len(body.Blocks))
+
+	for _, item := range sourceOrder(body) {
+		switch item := item.(type) {
+		case *hclsyntax.Attribute:
+			value, err := c.convertAttribute(item, blockType, spec)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, OrderedAttribute{Name: item.Name, Value: value})
+		case *hclsyntax.Block:
+			value, err := c.convertBodyOrdered(item.Body, item.Type, blockSpec(spec, item.Type))
+			if err != nil {
+				return nil, fmt.Errorf("convert body: %w", err)
+			}
+			out = append(out, OrderedBlock{Type: item.Type, Labels: append([]string{}, item.Labels...), Body: value})
 		}
 	}
 
 	return out, nil
 }
 
+func (c *converter) convertAttribute(attr *hclsyntax.Attribute, blockType string, spec *Spec) (interface{}, error) {
+	// Constant values are written with the type the spec gives the attribute
+	if ty := spec.AttributeType(attr.Name); ty != cty.NilType && ty != cty.DynamicPseudoType {
+		if value, ok := typedValue(attr.Expr, ty); ok {
+			return value, nil
+		}
+	}
+
+	// Terraform meta-arguments like depends_on hold references as plain strings in JSON
+	if c.options.Spec == nil && IsReferenceAttribute(attr.Name, blockType) {
+		if value, ok := c.referenceValue(attr.Expr); ok {
+			return value, nil
+		}
+	}
+
+	// Type constraints of variables are written as bare strings in JSON, e.g. "list(string)"
+	if c.options.Spec == nil && attr.Name == "type" && blockType == "variable" {
+		if _, _, diags := typeexpr.TypeConstraintWithDefaults(attr.Expr); !diags.HasErrors() {
+			return c.rangeSource(attr.Expr.Range()), nil
+		}
+	}
+
+	value, err := c.ConvertExpression(attr.Expr)
+	if err != nil {
+		return nil, fmt.Errorf("convert expression: %w", err)
+	}
+	return value, nil
+}
+
+// needsBlockList reports whether the blocks of body can't be written with nested labels,
+// because a block type is used with different numbers of labels or as an attribute name
+func needsBlockList(body *hclsyntax.Body) bool {
+	labelCounts := make(map[string]int)
+	for _, block := range body.Blocks {
+		if _, isAttribute := body.Attributes[block.Type]; isAttribute || block.Type == BlockListKey {
+			return true
+		}
+		if count, seen := labelCounts[block.Type]; seen && count != len(block.Labels) {
+			return true
+		}
+		labelCounts[block.Type] = len(block.Labels)
+	}
+	return false
+}
+
+func (c *converter) convertBlockList(blocks hclsyntax.Blocks, spec *Spec) ([]interface{}, error) {
+	list := make([]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		value, err := c.convertBody(block.Body, block.Type, blockSpec(spec, block.Type))
+		if err != nil {
+			return nil, fmt.Errorf("convert body: %w", err)
+		}
+
+		entry := NewObject()
+		entry.Set("type", block.Type)
+		entry.Set("labels", append([]string{}, block.Labels...))
+		entry.Set("body", value)
+		list = append(list, entry)
+	}
+	return list, nil
+}
+
 func (c *converter) rangeSource(r hcl.Range) string {
 	// for some reason the range doesn't include the ending paren, so
 	// check if the next character is an ending paren, and include it if it is.
@@ -129,7 +406,7 @@ func (c *converter) rangeSource(r hcl.Range) string {
 	return string(c.bytes[r.Start.Byte:end])
 }
 
-func (c *converter) convertBlock(block *hclsyntax.Block, out jsonObj) error {
+func (c *converter) convertBlock(block *hclsyntax.Block, out jsonObj, spec *Spec) error {
 	key := block.Type
 	for _, label := range block.Labels {
 
@@ -146,21 +423,22 @@ func (c *converter) convertBlock(block *hclsyntax.Block, out jsonObj) error {
 		// When the label exists, move onto the next label reference.
 		// When a label does not exist, create the label in the output and set that as the next label reference
 		// in order to append (potential) labels to it.
-		if _, exists := out[key]; exists {
+		if existing, exists := out.Get(key); exists {
 			var ok bool
-			out, ok = out[key].(jsonObj)
+			out, ok = existing.(jsonObj)
 			if !ok {
 				return fmt.Errorf("Unable to convert Block to JSON: %v.%v", block.Type, strings.Join(block.Labels, "."))
 			}
 		} else {
-			out[key] = make(jsonObj)
-			out = out[key].(jsonObj)
+			next := NewObject()
+			out.Set(key, next)
+			out = next
 		}
 
 		key = label
 	}
 
-	value, err := c.ConvertBody(block.Body)
+	value, err := c.convertBody(block.Body, block.Type, blockSpec(spec, block.Type))
 	if err != nil {
 		return fmt.Errorf("convert body: %w", err)
 	}
@@ -170,16 +448,16 @@ func (c *converter) convertBlock(block *hclsyntax.Block, out jsonObj) error {
 	//
 	// For consistency, always wrap the value in a collection.
 	// When multiple values are at the same key
-	if current, exists := out[key]; exists {
+	if current, exists := out.Get(key); exists {
 		switch currentTyped := current.(type) {
-		case []interface{}:
+		case blockInstances:
 			currentTyped = append(currentTyped, value)
-			out[key] = currentTyped
+			out.Set(key, currentTyped)
 		default:
 			return fmt.Errorf("invalid HCL detected for %q block, cannot have blocks with and without labels", key)
 		}
 	} else {
-		out[key] = []interface{}{value}
+		out.Set(key, blockInstances{value})
 	}
 
 	return nil
@@ -196,6 +474,9 @@ func (c *converter) ConvertExpression(expr hclsyntax.Expression) (interface{}, e
 	// assume it is hcl syntax (because, um, it is)
 	switch value := expr.(type) {
 	case *hclsyntax.LiteralValueExpr:
+		if literal, ok := c.numberLiteral(value, ""); ok {
+			return literal, nil
+		}
 		return ctyjson.SimpleJSONValue{Value: value.Val}, nil
 	case *hclsyntax.ScopeTraversalExpr:
 		// Handle simple identifiers like 'string', 'number', etc.
@@ -225,16 +506,17 @@ func (c *converter) ConvertExpression(expr hclsyntax.Expression) (interface{}, e
 		}
 		return list, nil
 	case *hclsyntax.ObjectConsExpr:
-		m := make(jsonObj)
+		m := NewObject()
 		for _, item := range value.Items {
 			key, err := c.convertKey(item.KeyExpr)
 			if err != nil {
 				return nil, err
 			}
-			m[key], err = c.ConvertExpression(item.ValueExpr)
+			elem, err := c.ConvertExpression(item.ValueExpr)
 			if err != nil {
 				return nil, err
 			}
+			m.Set(key, elem)
 		}
 		return m, nil
 	default:
@@ -243,12 +525,17 @@ func (c *converter) ConvertExpression(expr hclsyntax.Expression) (interface{}, e
 }
 
 func (c *converter) convertUnary(v *hclsyntax.UnaryOpExpr) (interface{}, error) {
-	_, isLiteral := v.Val.(*hclsyntax.LiteralValueExpr)
+	literal, isLiteral := v.Val.(*hclsyntax.LiteralValueExpr)
 	if !isLiteral {
 		// If the expression after the operator isn't a literal, fall back to
 		// wrapping the expression with ${...}
 		return c.wrapExpr(v), nil
 	}
+	if v.Op == hclsyntax.OpNegate {
+		if number, ok := c.numberLiteral(literal, "-"); ok {
+			return number, nil
+		}
+	}
 	val, err := v.Value(nil)
 	if err != nil {
 		return nil, err
@@ -256,6 +543,20 @@ func (c *converter) convertUnary(v *hclsyntax.UnaryOpExpr) (interface{}, error)
 	return ctyjson.SimpleJSONValue{Value: val}, nil
 }
 
+// numberLiteral returns the source text of a number literal, with prefix, when it is also a
+// valid JSON number, so 1.0, 1e3 or 9223372036854775808 keep their text
+func (c *converter) numberLiteral(expr *hclsyntax.LiteralValueExpr, prefix string) (json.RawMessage, bool) {
+	if expr.Val.Type() != cty.Number || expr.Val.IsNull() {
+		return nil, false
+	}
+	text := prefix + c.rangeSource(expr.Range())
+	var number json.Number
+	if err := json.Unmarshal([]byte(text), &number); err != nil || number.String() != text {
+		return nil, false
+	}
+	return json.RawMessage(text), true
+}
+
 // Escape sequences that have special meaning in hcl json
 // such as ${ that come from literals, that shouldn't have
 // real interpolation
@@ -0,0 +1,130 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Object is a JSON object that keeps its keys in insertion order. The converter inserts
+// keys in HCL source order, so the JSON reads in the same order as the HCL it came from.
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewObject returns an empty Object.
+func NewObject() *Object {
+	return &Object{values: make(map[string]interface{})}
+}
+
+// Set sets the value of key. A key that already exists keeps its position.
+func (o *Object) Set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Get returns the value of key and whether it exists.
+func (o *Object) Get(key string) (interface{}, bool) {
+	value, exists := o.values[key]
+	return value, exists
+}
+
+// Keys returns the keys in insertion order.
+func (o *Object) Keys() []string {
+	return append([]string{}, o.keys...)
+}
+
+// Len returns the number of keys.
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Map returns the object as a plain map, with nested objects converted too. The order of
+// the keys is lost.
+func (o *Object) Map() map[string]interface{} {
+	out := make(map[string]interface{}, len(o.keys))
+	for _, key := range o.keys {
+		out[key] = plainValue(o.values[key])
+	}
+	return out
+}
+
+// plainValue converts the objects in value to plain maps and its arrays to plain slices
+func plainValue(value interface{}) interface{} {
+	var elems []interface{}
+	switch typed := value.(type) {
+	case *Object:
+		return typed.Map()
+	case blockInstances:
+		elems = typed
+	case []interface{}:
+		elems = typed
+	default:
+		return value
+	}
+
+	out := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		out[i] = plainValue(elem)
+	}
+	return out
+}
+
+// orderedValue converts the arrays in value to plain slices, keeping its objects
+func orderedValue(value interface{}) interface{} {
+	var elems []interface{}
+	switch typed := value.(type) {
+	case *Object:
+		for _, key := range typed.keys {
+			typed.values[key] = orderedValue(typed.values[key])
+		}
+		return typed
+	case blockInstances:
+		elems = typed
+	case []interface{}:
+		elems = typed
+	default:
+		return value
+	}
+
+	out := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		out[i] = orderedValue(elem)
+	}
+	return out
+}
+
+// MarshalJSON writes the object with its keys in insertion order.
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeJSON(&buf, key); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := encodeJSON(&buf, o.values[key]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// encodeJSON writes value as compact JSON without escaping <, > and &, which
+// are common in HCL expressions such as version constraints.
+func encodeJSON(buf *bytes.Buffer, value interface{}) error {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	// Encode terminates every value with a newline
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
@@ -0,0 +1,60 @@
+package convert
+
+import (
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// referenceAttributes maps the Terraform meta-arguments whose values are references rather
+// than expressions to the block types they occur in
+var referenceAttributes = map[string]map[string]bool{
+	"depends_on":     {"resource": true, "data": true, "module": true, "output": true},
+	"provider":       {"resource": true, "data": true},
+	"providers":      {"module": true},
+	"ignore_changes": {"lifecycle": true},
+	"iterator":       {"dynamic": true},
+	"when":           {"provisioner": true},
+	"on_failure":     {"provisioner": true},
+}
+
+// IsReferenceAttribute reports whether the attribute name of a blockType block is a
+// Terraform meta-argument holding references, which Terraform JSON writes as plain strings
+// like "aws.west" or "aws_s3_bucket.logs" instead of templates
+func IsReferenceAttribute(name, blockType string) bool {
+	return referenceAttributes[name][blockType]
+}
+
+// referenceValue converts a reference, or a list or object of references, to the plain
+// strings of Terraform JSON. It fails for any other expression.
+func (c *converter) referenceValue(expr hclsyntax.Expression) (interface{}, bool) {
+	switch expr := expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr:
+		return c.rangeSource(expr.Range()), true
+	case *hclsyntax.TupleConsExpr:
+		list := make([]interface{}, 0, len(expr.Exprs))
+		for _, elem := range expr.Exprs {
+			value, ok := c.referenceValue(elem)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, value)
+		}
+		return list, true
+	case *hclsyntax.ObjectConsExpr:
+		// providers = { aws.target = aws.west }
+		object := NewObject()
+		for _, item := range expr.Items {
+			key, err := c.convertKey(item.KeyExpr)
+			if err != nil {
+				return nil, false
+			}
+			value, ok := c.referenceValue(item.ValueExpr)
+			if !ok {
+				return nil, false
+			}
+			object.Set(key, value)
+		}
+		return object, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,172 @@
+package convert
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyconvert "github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Spec describes the attributes and nested blocks of a body, as given by an hcldec spec.
+type Spec struct {
+	// Attributes maps attribute names to their types
+	Attributes map[string]cty.Type
+
+	// ElementType is the type of every attribute of a block_attrs body, cty.NilType otherwise
+	ElementType cty.Type
+
+	// Blocks maps block type names to their number of labels and body
+	Blocks map[string]*SpecBlock
+}
+
+// SpecBlock describes a nested block type of a Spec.
+type SpecBlock struct {
+	Labels int
+	Body   *Spec
+}
+
+// NewSpec collects the body structure described by an hcldec spec.
+func NewSpec(spec hcldec.Spec) *Spec {
+	body := &Spec{
+		Attributes:  make(map[string]cty.Type),
+		ElementType: cty.NilType,
+		Blocks:      make(map[string]*SpecBlock),
+	}
+	body.add(spec)
+	return body
+}
+
+// add records the attributes and blocks of spec, which decodes from this body
+func (s *Spec) add(spec hcldec.Spec) {
+	switch spec := spec.(type) {
+	case hcldec.ObjectSpec:
+		for _, nested := range spec {
+			s.add(nested)
+		}
+	case hcldec.TupleSpec:
+		for _, nested := range spec {
+			s.add(nested)
+		}
+	case *hcldec.AttrSpec:
+		s.Attributes[spec.Name] = spec.Type
+	case *hcldec.BlockSpec:
+		s.addBlock(spec.TypeName, 0, spec.Nested)
+	case *hcldec.BlockListSpec:
+		s.addBlock(spec.TypeName, 0, spec.Nested)
+	case *hcldec.BlockTupleSpec:
+		s.addBlock(spec.TypeName, 0, spec.Nested)
+	case *hcldec.BlockSetSpec:
+		s.addBlock(spec.TypeName, 0, spec.Nested)
+	case *hcldec.BlockMapSpec:
+		s.addBlock(spec.TypeName, len(spec.LabelNames), spec.Nested)
+	case *hcldec.BlockObjectSpec:
+		s.addBlock(spec.TypeName, len(spec.LabelNames), spec.Nested)
+	case *hcldec.BlockAttrsSpec:
+		block := NewSpec(nil)
+		block.ElementType = spec.ElementType
+		s.Blocks[spec.TypeName] = &SpecBlock{Body: block}
+	case *hcldec.DefaultSpec:
+		s.add(spec.Primary)
+		s.add(spec.Default)
+	case *hcldec.TransformExprSpec:
+		s.add(spec.Wrapped)
+	case *hcldec.TransformFuncSpec:
+		s.add(spec.Wrapped)
+	case *hcldec.ValidateSpec:
+		s.add(spec.Wrapped)
+	}
+}
+
+// addBlock records a nested block type, merging specs that share a block type
+func (s *Spec) addBlock(typeName string, labels int, nested hcldec.Spec) {
+	block, exists := s.Blocks[typeName]
+	if !exists {
+		block = &SpecBlock{Labels: labels, Body: NewSpec(nil)}
+		s.Blocks[typeName] = block
+	}
+	block.Body.add(nested)
+}
+
+// AttributeType returns the type of the named attribute, or cty.NilType when the spec
+// doesn't know it.
+func (s *Spec) AttributeType(name string) cty.Type {
+	if s == nil {
+		return cty.NilType
+	}
+	if ty, ok := s.Attributes[name]; ok {
+		return ty
+	}
+	return s.ElementType
+}
+
+// Block returns the named nested block type, or nil when the spec doesn't know it.
+func (s *Spec) Block(typeName string) *SpecBlock {
+	if s == nil {
+		return nil
+	}
+	return s.Blocks[typeName]
+}
+
+// blockSpec returns the spec of the body of a typeName block, or nil when it is unknown
+func blockSpec(spec *Spec, typeName string) *Spec {
+	if block := spec.Block(typeName); block != nil {
+		return block.Body
+	}
+	return nil
+}
+
+// checkBlockLabels reports blocks of body with a different number of labels than spec expects
+func checkBlockLabels(body *hclsyntax.Body, spec *Spec) error {
+	for _, block := range body.Blocks {
+		if specBlock := spec.Block(block.Type); specBlock != nil && len(block.Labels) != specBlock.Labels {
+			return fmt.Errorf("%s block at %s has %d labels, the spec expects %d",
+				block.Type, block.DefRange(), len(block.Labels), specBlock.Labels)
+		}
+	}
+	return nil
+}
+
+// typedValue evaluates a constant expression and converts it to ty, reporting false when
+// the expression isn't constant or can't be converted
+func typedValue(expr hclsyntax.Expression, ty cty.Type) (interface{}, bool) {
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || !val.IsWhollyKnown() {
+		return nil, false
+	}
+	converted, err := ctyconvert.Convert(val, ty)
+	if err != nil {
+		return nil, false
+	}
+	return jsonValue(converted), true
+}
+
+// jsonValue converts a known value to its JSON representation, escaping template
+// sequences in strings
+func jsonValue(val cty.Value) interface{} {
+	ty := val.Type()
+	switch {
+	case val.IsNull():
+		return nil
+	case ty == cty.String:
+		return escapeLiteral(val.AsString())
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		list := make([]interface{}, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			list = append(list, jsonValue(elem))
+		}
+		return list
+	case ty.IsMapType() || ty.IsObjectType():
+		obj := NewObject()
+		for it := val.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			obj.Set(key.AsString(), jsonValue(elem))
+		}
+		return obj
+	default:
+		return ctyjson.SimpleJSONValue{Value: val}
+	}
+}
@@ -0,0 +1,54 @@
+package convert
+
+import (
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// terraformObjectBlocks maps the Terraform block types that JSON writes as an object, rather
+// than an array of bodies, when they occur once, to the block types they are nested in. An
+// empty parent matches any nested block, like for dynamic blocks.
+var terraformObjectBlocks = map[string]map[string]bool{
+	"lifecycle":          {"resource": true, "data": true},
+	"connection":         {"resource": true, "provisioner": true},
+	"dynamic":            {"": true},
+	"content":            {"dynamic": true},
+	"backend":            {"terraform": true},
+	"cloud":              {"terraform": true},
+	"workspaces":         {"cloud": true},
+	"required_providers": {"terraform": true},
+}
+
+// terraformBlocks reports whether the nested blocks follow Terraform's JSON syntax, which
+// only applies to Terraform input converted without a spec
+func (c *converter) terraformBlocks() bool {
+	return c.options.Terraform && c.options.Spec == nil
+}
+
+// isTerraformObjectBlock reports whether Terraform JSON writes the blocks of blockType nested
+// in a parentType block as objects
+func isTerraformObjectBlock(blockType, parentType string) bool {
+	parents := terraformObjectBlocks[blockType]
+	return parents[parentType] || (parents[""] && parentType != "")
+}
+
+// isTerraformOrderedBlock reports whether Terraform JSON writes the blocks of blockType nested
+// in a parentType block as an array of label objects, because their order matters
+func isTerraformOrderedBlock(blockType, parentType string) bool {
+	return blockType == "provisioner" && parentType == "resource"
+}
+
+// convertOrderedBlock appends a block with a single label to the array of label objects of
+// its type in out, like "provisioner": [{"file": {...}}, {"local-exec": {...}}]
+func (c *converter) convertOrderedBlock(block *hclsyntax.Block, out jsonObj) error {
+	value, err := c.convertBody(block.Body, block.Type, nil)
+	if err != nil {
+		return err
+	}
+
+	entry := NewObject()
+	entry.Set(block.Labels[0], value)
+	list, _ := out.Get(block.Type)
+	entries, _ := list.([]interface{})
+	out.Set(block.Type, append(entries, entry))
+	return nil
+}
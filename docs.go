@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Markers delimiting the generated section when injecting docs into an existing file
+const (
+	docsBeginMarker = "<!-- BEGIN_JSON2HCL_DOCS -->"
+	docsEndMarker   = "<!-- END_JSON2HCL_DOCS -->"
+)
+
+// moduleDocs is everything documented about a module
+type moduleDocs struct {
+	Requirements []docsRequirement `json:"requirements"`
+	Providers    []docsProvider    `json:"providers"`
+	Modules      []docsModuleCall  `json:"modules"`
+	Resources    []docsResource    `json:"resources"`
+	Inputs       []docsInput       `json:"inputs"`
+	Outputs      []docsOutput      `json:"outputs"`
+}
+
+type docsRequirement struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type docsProvider struct {
+	Name    string   `json:"name"`
+	Source  string   `json:"source,omitempty"`
+	Version string   `json:"version,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+type docsModuleCall struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+}
+
+type docsResource struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+}
+
+type docsInput struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Type        string          `json:"type"`
+	Default     json.RawMessage `json:"default,omitempty"`
+	Required    bool            `json:"required"`
+	Sensitive   bool            `json:"sensitive,omitempty"`
+}
+
+type docsOutput struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Sensitive   bool   `json:"sensitive,omitempty"`
+}
+
+var docsFileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "terraform"},
+		{Type: "provider", LabelNames: []string{"name"}},
+		{Type: "module", LabelNames: []string{"name"}},
+		{Type: "resource", LabelNames: []string{"type", "name"}},
+		{Type: "data", LabelNames: []string{"type", "name"}},
+		{Type: "output", LabelNames: []string{"name"}},
+	},
+}
+
+// runDocs implements the `docs` command
+func runDocs(args []string) error {
+	flags := flag.NewFlagSet("docs", flag.ExitOnError)
+	format := flags.String("format", "markdown", "Output format: markdown or json")
+	inject := flags.String("inject", "", "Replace the section between "+docsBeginMarker+" and "+docsEndMarker+" in this file instead of printing")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: json2hcl docs [-format markdown|json] [-inject README.md] <module dir or .tf file>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("docs requires at least one module directory or file")
+	}
+
+	files, err := parseModuleFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+	docs, err := collectModuleDocs(files)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	switch *format {
+	case "markdown":
+		out.WriteString(docs.Markdown())
+	case "json":
+		encoder := json.NewEncoder(&out)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(docs); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown docs format %q, expected markdown or json", *format)
+	}
+
+	if *inject == "" {
+		fmt.Print(out.String())
+		return nil
+	}
+	return injectDocs(*inject, out.Bytes())
+}
+
+// collectModuleDocs gathers the documented parts of a module, sorted by name
+func collectModuleDocs(files []*hcl.File) (*moduleDocs, error) {
+	docs := &moduleDocs{
+		Requirements: []docsRequirement{},
+		Providers:    []docsProvider{},
+		Modules:      []docsModuleCall{},
+		Resources:    []docsResource{},
+		Inputs:       []docsInput{},
+		Outputs:      []docsOutput{},
+	}
+	providers := make(map[string]*docsProvider)
+	provider := func(name string) *docsProvider {
+		if _, ok := providers[name]; !ok {
+			providers[name] = &docsProvider{Name: name}
+		}
+		return providers[name]
+	}
+
+	for _, file := range files {
+		content, _, diags := file.Body.PartialContent(docsFileSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("unable to read module: %s", diags.Error())
+		}
+
+		for _, block := range content.Blocks {
+			attrs := blockAttributes(block)
+			switch block.Type {
+			case "terraform":
+				if err := collectTerraformDocs(block, docs, provider); err != nil {
+					return nil, err
+				}
+			case "provider":
+				p := provider(block.Labels[0])
+				if alias := attributeString(attrs, "alias"); alias != "" {
+					p.Aliases = append(p.Aliases, alias)
+				}
+			case "module":
+				docs.Modules = append(docs.Modules, docsModuleCall{
+					Name:    block.Labels[0],
+					Source:  attributeString(attrs, "source"),
+					Version: attributeString(attrs, "version"),
+				})
+			case "resource", "data":
+				address := block.Labels[0] + "." + block.Labels[1]
+				mode := "managed"
+				if block.Type == "data" {
+					address, mode = "data."+address, "data"
+				}
+				docs.Resources = append(docs.Resources, docsResource{Address: address, Mode: mode, Type: block.Labels[0]})
+				provider(strings.SplitN(block.Labels[0], "_", 2)[0])
+			case "output":
+				docs.Outputs = append(docs.Outputs, docsOutput{
+					Name:        block.Labels[0],
+					Description: attributeString(attrs, "description"),
+					Sensitive:   attributeBool(attrs, "sensitive"),
+				})
+			}
+		}
+	}
+
+	variables, err := fileVariables(files)
+	if err != nil {
+		return nil, err
+	}
+	for _, variable := range variables {
+		input := docsInput{
+			Name:        variable.Name,
+			Description: variable.Description,
+			Type:        "any",
+			Required:    variable.Required(),
+			Sensitive:   variable.Sensitive,
+		}
+		if variable.TypeSource != "" {
+			input.Type = strings.Join(strings.Fields(variable.TypeSource), " ")
+		}
+		if variable.HasDefault && variable.Default != cty.NilVal {
+			input.Default, err = json.Marshal(ctyjson.SimpleJSONValue{Value: variable.Default})
+			if err != nil {
+				return nil, err
+			}
+		}
+		docs.Inputs = append(docs.Inputs, input)
+	}
+
+	for _, p := range providers {
+		sort.Strings(p.Aliases)
+		docs.Providers = append(docs.Providers, *p)
+	}
+
+	sort.SliceStable(docs.Requirements, func(i, j int) bool {
+		// terraform itself always comes first
+		if (docs.Requirements[i].Name == "terraform") != (docs.Requirements[j].Name == "terraform") {
+			return docs.Requirements[i].Name == "terraform"
+		}
+		return docs.Requirements[i].Name < docs.Requirements[j].Name
+	})
+	sort.Slice(docs.Providers, func(i, j int) bool { return docs.Providers[i].Name < docs.Providers[j].Name })
+	sort.Slice(docs.Modules, func(i, j int) bool { return docs.Modules[i].Name < docs.Modules[j].Name })
+	sort.Slice(docs.Resources, func(i, j int) bool { return docs.Resources[i].Address < docs.Resources[j].Address })
+	sort.Slice(docs.Inputs, func(i, j int) bool { return docs.Inputs[i].Name < docs.Inputs[j].Name })
+	sort.Slice(docs.Outputs, func(i, j int) bool { return docs.Outputs[i].Name < docs.Outputs[j].Name })
+
+	return docs, nil
+}
+
+// collectTerraformDocs reads required_version and required_providers from a terraform block
+func collectTerraformDocs(block *hcl.Block, docs *moduleDocs, provider func(string) *docsProvider) error {
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "required_version"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "required_providers"}},
+	})
+	if diags.HasErrors() {
+		return fmt.Errorf("unable to read terraform block: %s", diags.Error())
+	}
+
+	if version := attributeString(content.Attributes, "required_version"); version != "" {
+		docs.Requirements = append(docs.Requirements, docsRequirement{Name: "terraform", Version: version})
+	}
+
+	for _, required := range content.Blocks {
+		attrs, diags := required.Body.JustAttributes()
+		if diags.HasErrors() {
+			return fmt.Errorf("unable to read required_providers: %s", diags.Error())
+		}
+		for name, attr := range attrs {
+			val, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				return fmt.Errorf("unable to read required provider %q: %s", name, diags.Error())
+			}
+
+			p := provider(name)
+			switch {
+			case val.Type().Equals(cty.String) && !val.IsNull():
+				// Legacy shorthand: aws = "~> 3.0"
+				p.Version = val.AsString()
+			case val.Type().IsObjectType() && !val.IsNull():
+				for key, target := range map[string]*string{"source": &p.Source, "version": &p.Version} {
+					if val.Type().HasAttribute(key) {
+						if attrVal := val.GetAttr(key); attrVal.Type().Equals(cty.String) && !attrVal.IsNull() {
+							*target = attrVal.AsString()
+						}
+					}
+				}
+			}
+			docs.Requirements = append(docs.Requirements, docsRequirement{Name: name, Version: p.Version})
+		}
+	}
+
+	return nil
+}
+
+// blockAttributes returns the documented attributes of a block, ignoring everything else
+func blockAttributes(block *hcl.Block) hcl.Attributes {
+	content, _, _ := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "alias"},
+			{Name: "description"},
+			{Name: "sensitive"},
+			{Name: "source"},
+			{Name: "version"},
+		},
+	})
+	return content.Attributes
+}
+
+// attributeString returns a string attribute, or "" when it is missing or not a constant string
+func attributeString(attrs hcl.Attributes, name string) string {
+	attr, ok := attrs[name]
+	if !ok {
+		return ""
+	}
+	val, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || !val.Type().Equals(cty.String) || val.IsNull() {
+		return ""
+	}
+	return val.AsString()
+}
+
+// attributeBool returns a boolean attribute, or false when it is missing or not a constant
+func attributeBool(attrs hcl.Attributes, name string) bool {
+	attr, ok := attrs[name]
+	if !ok {
+		return false
+	}
+	val, diags := attr.Expr.Value(nil)
+	return !diags.HasErrors() && val.Type().Equals(cty.Bool) && !val.IsNull() && val.True()
+}
+
+// Markdown renders the docs as Markdown tables
+func (d *moduleDocs) Markdown() string {
+	var builder strings.Builder
+
+	section := func(title, empty string, header []string, rows [][]string) {
+		if builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+		builder.WriteString("## " + title + "\n\n")
+		if len(rows) == 0 {
+			builder.WriteString(empty + "\n")
+			return
+		}
+		builder.WriteString("| " + strings.Join(header, " | ") + " |\n")
+		builder.WriteString("|" + strings.Repeat("------|", len(header)) + "\n")
+		for _, row := range rows {
+			builder.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		}
+	}
+
+	var rows [][]string
+	for _, r := range d.Requirements {
+		rows = append(rows, []string{r.Name, markdownCell(r.Version)})
+	}
+	section("Requirements", "No requirements.", []string{"Name", "Version"}, rows)
+
+	rows = nil
+	for _, p := range d.Providers {
+		rows = append(rows, []string{p.Name, markdownCell(p.Source), markdownCell(p.Version), markdownCell(strings.Join(p.Aliases, ", "))})
+	}
+	section("Providers", "No providers.", []string{"Name", "Source", "Version", "Aliases"}, rows)
+
+	rows = nil
+	for _, m := range d.Modules {
+		rows = append(rows, []string{m.Name, markdownCode(m.Source), markdownCell(m.Version)})
+	}
+	section("Modules", "No modules.", []string{"Name", "Source", "Version"}, rows)
+
+	rows = nil
+	for _, r := range d.Resources {
+		rows = append(rows, []string{markdownCode(r.Address), r.Mode})
+	}
+	section("Resources", "No resources.", []string{"Name", "Mode"}, rows)
+
+	rows = nil
+	for _, i := range d.Inputs {
+		defaultValue := "n/a"
+		if i.Default != nil {
+			defaultValue = markdownCode(string(i.Default))
+		}
+		required := "no"
+		if i.Required {
+			required = "yes"
+		}
+		rows = append(rows, []string{i.Name, markdownCell(i.Description), markdownCode(i.Type), defaultValue, required})
+	}
+	section("Inputs", "No inputs.", []string{"Name", "Description", "Type", "Default", "Required"}, rows)
+
+	rows = nil
+	for _, o := range d.Outputs {
+		sensitive := "no"
+		if o.Sensitive {
+			sensitive = "yes"
+		}
+		rows = append(rows, []string{o.Name, markdownCell(o.Description), sensitive})
+	}
+	section("Outputs", "No outputs.", []string{"Name", "Description", "Sensitive"}, rows)
+
+	return builder.String()
+}
+
+// markdownCell escapes text for use inside a table cell
+func markdownCell(text string) string {
+	if text == "" {
+		return "n/a"
+	}
+	text = strings.ReplaceAll(strings.TrimSpace(text), "|", "\\|")
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
+
+// markdownCode renders text as inline code inside a table cell
+func markdownCode(text string) string {
+	if text == "" {
+		return "n/a"
+	}
+	return "`" + markdownCell(text) + "`"
+}
+
+// injectDocs replaces the content between the docs markers in path
+func injectDocs(path string, docs []byte) error {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %s", path, err)
+	}
+
+	begin := bytes.Index(existing, []byte(docsBeginMarker))
+	end := bytes.Index(existing, []byte(docsEndMarker))
+	if begin < 0 || end < begin {
+		return fmt.Errorf("%s has no %s ... %s section to replace", path, docsBeginMarker, docsEndMarker)
+	}
+
+	var out bytes.Buffer
+	out.Write(existing[:begin+len(docsBeginMarker)])
+	out.WriteString("\n")
+	out.Write(docs)
+	out.Write(existing[end:])
+
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// Reasons for turning a JSON key into a block or an attribute, as reported by -explain
+const (
+	reasonKnownBlock = "known block type"
+	reasonDeclared   = "declared block type"
+	reasonSpec       = "spec"
+	reasonStructure  = "structural heuristic"
+	reasonTFVars     = "tfvars mode"
+	reasonValueShape = "value shape"
+	reasonEncoding   = "explicit encoding"
+	reasonFallback   = "fallback after error"
+)
+
+// blockDecision is the outcome of telling whether a JSON key holds blocks or an attribute
+type blockDecision struct {
+	block  bool
+	reason string
+	rule   string
+}
+
+// blockBecause returns a decision for blocks
+func blockBecause(reason, rule string) blockDecision {
+	return blockDecision{block: true, reason: reason, rule: rule}
+}
+
+// attributeBecause returns a decision for an attribute
+func attributeBecause(reason, rule string) blockDecision {
+	return blockDecision{reason: reason, rule: rule}
+}
+
+// fallbackDecision returns the decision for a key whose block conversion failed, which is
+// then written as an attribute
+func fallbackDecision(err error) blockDecision {
+	return attributeBecause(reasonFallback, "block conversion failed: "+err.Error())
+}
+
+// explanation is a decision taken for a JSON path, as printed by -explain
+type explanation struct {
+	Path     string `json:"path"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason"`
+	Rule     string `json:"rule"`
+}
+
+// decisionLog collects the decisions of a forward conversion for -explain
+type decisionLog struct {
+	// paths maps the bodies of converted blocks to their JSON path
+	paths   map[*hclwrite.Body]string
+	entries []explanation
+	seen    map[explanation]bool
+}
+
+// explainer is set by -explain, the conversion records its decisions in it
+var explainer *decisionLog
+
+// newDecisionLog returns an empty decisionLog
+func newDecisionLog() *decisionLog {
+	return &decisionLog{
+		paths: make(map[*hclwrite.Body]string),
+		seen:  make(map[explanation]bool),
+	}
+}
+
+// appendBlock appends a block to nativeBody, remembering its JSON path for -explain
+func appendBlock(nativeBody *hclwrite.Body, blockType string, labels []string) *hclwrite.Block {
+	nativeBlock := nativeBody.AppendNewBlock(blockType, labels)
+	if explainer != nil {
+		path := jsonPathKey(explainer.paths[nativeBody], blockType)
+		for _, label := range labels {
+			path = jsonPathKey(path, label)
+		}
+		explainer.paths[nativeBlock.Body()] = path
+	}
+	return nativeBlock
+}
+
+// explainDecision records the decision taken for the key name of the body being written
+// to nativeBody
+func explainDecision(nativeBody *hclwrite.Body, name string, decision blockDecision) {
+	if explainer == nil {
+		return
+	}
+
+	entry := explanation{
+		Path:     jsonPathKey(explainer.paths[nativeBody], name),
+		Decision: "attribute",
+		Reason:   decision.reason,
+		Rule:     decision.rule,
+	}
+	if decision.block {
+		entry.Decision = "block"
+	}
+
+	// Blocks sharing a type and labels repeat the decisions for their keys
+	if !explainer.seen[entry] {
+		explainer.seen[entry] = true
+		explainer.entries = append(explainer.entries, entry)
+	}
+}
+
+// jsonPathKey appends key to a path in the syntax of the query command
+func jsonPathKey(path, key string) string {
+	if !hclsyntax.ValidIdentifier(key) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// write prints the recorded decisions ordered by path, as text or json
+func (l *decisionLog) write(w io.Writer, format string) error {
+	entries := append([]explanation{}, l.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case "text":
+		width := 0
+		for _, entry := range entries {
+			if len(entry.Path) > width {
+				width = len(entry.Path)
+			}
+		}
+		for _, entry := range entries {
+			line := fmt.Sprintf("%-*s  %-9s  %s: %s", width, entry.Path, entry.Decision, entry.Reason, entry.Rule)
+			fmt.Fprintln(w, strings.TrimRight(line, " "))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown -explain format %q, expected text or json", format)
+	}
+}
@@ -0,0 +1,22 @@
+resource "aws_security_group" "web" {
+  dynamic "egress" {
+    content {
+      cidr_blocks = egress.value.cidr_blocks
+      from_port   = egress.value.port
+      protocol    = "tcp"
+      to_port     = egress.value.port
+    }
+    for_each = var.egress_rules
+  }
+  dynamic "ingress" {
+    content {
+      from_port = port.value
+      protocol  = "tcp"
+      to_port   = port.value
+    }
+    for_each = var.ports
+    iterator = port
+    labels   = []
+  }
+  name = "web"
+}
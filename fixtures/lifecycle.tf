@@ -0,0 +1,24 @@
+data "aws_ami" "ubuntu" {
+  lifecycle {
+    postcondition {
+      condition     = self.is_x86_64
+      error_message = "The AMI must be for x86_64."
+    }
+  }
+  most_recent = true
+}
+resource "aws_instance" "web" {
+  ami = "ami-123"
+  lifecycle {
+    create_before_destroy = true
+    ignore_changes        = [tags, user_data]
+    postcondition {
+      condition     = self.associate_public_ip_address
+      error_message = "The instance needs a public IP."
+    }
+    precondition {
+      condition     = var.enabled
+      error_message = "The instance must be enabled."
+    }
+  }
+}
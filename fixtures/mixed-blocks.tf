@@ -0,0 +1,9 @@
+widget {
+  size = 1
+}
+widget "named" {
+  size = 2
+}
+resource "aws_instance" "web" {
+  ami = "ami-1"
+}
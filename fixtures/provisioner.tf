@@ -0,0 +1,28 @@
+resource "aws_instance" "web" {
+  ami = "ami-123"
+  connection {
+    host = self.public_ip
+    type = "ssh"
+    user = "root"
+  }
+  provisioner "file" {
+    destination = "/etc/app.conf"
+    source      = "app.conf"
+  }
+  provisioner "remote-exec" {
+    connection {
+      host = self.private_ip
+      type = "ssh"
+      user = "admin"
+    }
+    inline = ["sudo systemctl restart app"]
+  }
+  provisioner "local-exec" {
+    command    = "echo ${self.private_ip} >> hosts"
+    on_failure = continue
+  }
+  provisioner "local-exec" {
+    command = "echo destroyed"
+    when    = destroy
+  }
+}
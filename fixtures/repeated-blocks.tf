@@ -0,0 +1,24 @@
+locals {
+  name = "app"
+}
+resource "null_resource" "setup" {
+  provisioner "local-exec" {
+    command = "echo one"
+  }
+  provisioner "local-exec" {
+    command = "echo two"
+  }
+}
+data "aws_ami" "a" {
+  most_recent = true
+}
+data "aws_ami" "b" {
+  most_recent = false
+}
+provider "aws" {
+  region = "eu-west-1"
+}
+provider "aws" {
+  alias  = "us"
+  region = "us-east-1"
+}
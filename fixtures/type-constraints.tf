@@ -0,0 +1,16 @@
+variable "names" {
+  type = list(string)
+}
+variable "ports" {
+  type = map(number)
+}
+variable "services" {
+  type = map(object({ name = string, port = optional(number, 80), tags = optional(set(string)) }))
+}
+variable "region" {
+  type    = string
+  default = "us-east-1"
+}
+variable "pair" {
+  type = tuple([string, bool])
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// fmtOptions are the rules the fmt command applies on top of hclwrite.Format
+type fmtOptions struct {
+	// sort orders the attributes and blocks of every body by name, like generated HCL
+	sort bool
+	// unwrap rewrites interpolation-only strings like "${var.x}" to var.x
+	unwrap bool
+	layout lineLayout
+}
+
+// runFmt implements the `fmt` command
+func runFmt(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "Only list the files that are not formatted, failing if there are any")
+	diff := flags.Bool("diff", false, "Print the changes formatting makes as a unified diff")
+	write := flags.Bool("write", true, "Write formatted files in place, -write=false leaves them untouched")
+	sortBodies := flags.Bool("sort", false, "Order the attributes and blocks of every body by name like generated HCL, blocks of the same type keep their order")
+	unwrap := flags.Bool("unwrap-interpolations", false, "Rewrite interpolation-only strings like \"${var.x}\" to var.x")
+	maxWidth := flags.Int("max-width", 0, "Keep lists and objects on one line when they fit in this many columns and write one element per line otherwise, 0 keeps the default layout")
+	trailingCommas := flags.Bool("trailing-commas", false, "With -max-width, end every element of a wrapped list with a comma, including the last")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: json2hcl fmt [-check] [-diff] [-write=false] [file.tf|dir...] (stdin to stdout without files)")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *maxWidth < 0 {
+		return fmt.Errorf("-max-width must not be negative")
+	}
+	if *trailingCommas && *maxWidth == 0 {
+		return fmt.Errorf("-trailing-commas requires -max-width")
+	}
+	options := fmtOptions{
+		sort:   *sortBodies,
+		unwrap: *unwrap,
+		layout: lineLayout{maxWidth: *maxWidth, trailingCommas: *trailingCommas},
+	}
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("unable to read from stdin: %s", err)
+		}
+		formatted, err := formatHCL(src, "<stdin>", options)
+		if err != nil {
+			return err
+		}
+		switch {
+		case *diff:
+			fmt.Print(unifiedDiff("<stdin>", src, formatted))
+		case !*check:
+			fmt.Print(string(formatted))
+		}
+		if *check && !bytes.Equal(src, formatted) {
+			return fmt.Errorf("<stdin> is not formatted")
+		}
+		return nil
+	}
+
+	filenames, err := fmtFiles(flags.Args())
+	if err != nil {
+		return fmt.Errorf("unable to list files: %s", err)
+	}
+
+	var unformatted []string
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %s", filename, err)
+		}
+		formatted, err := formatHCL(src, filename, options)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(src, formatted) {
+			continue
+		}
+
+		unformatted = append(unformatted, filename)
+		fmt.Println(filename)
+		if *diff {
+			fmt.Print(unifiedDiff(filename, src, formatted))
+		}
+		if *check || !*write {
+			continue
+		}
+		if err := os.WriteFile(filename, formatted, 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %s", filename, err)
+		}
+	}
+
+	if *check && len(unformatted) > 0 {
+		return fmt.Errorf("%d of %d files are not formatted", len(unformatted), len(filenames))
+	}
+	return nil
+}
+
+// fmtFiles expands files and directories into the native syntax files they contain
+func fmtFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".tf", ".tfvars", ".hcl":
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// formatHCL formats native syntax HCL the way json2hcl writes generated HCL
+func formatHCL(src []byte, filename string, options fmtOptions) ([]byte, error) {
+	file, diags := hclwrite.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to parse %s: %s", filename, diags.Error())
+	}
+
+	if options.unwrap {
+		unwrapInterpolations(file.Body())
+	}
+
+	if options.sort && sortBody(file.Body(), true) {
+		// Sorted bodies are unstructured tokens, parse them again for the layout
+		file, diags = hclwrite.ParseConfig(file.Bytes(), filename, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("unable to parse %s after sorting: %s", filename, diags.Error())
+		}
+	}
+
+	layoutFile(file, options.layout)
+	return hclwrite.Format(file.Bytes()), nil
+}
+
+// unwrapInterpolations rewrites the attributes of body and its nested blocks that are a
+// single interpolation of a simple reference, like "${var.x}", to the bare reference
+func unwrapInterpolations(body *hclwrite.Body) {
+	for name, attr := range body.Attributes() {
+		tokens := attr.Expr().BuildTokens(nil)
+		if len(tokens) < 2 || tokens[0].Type != hclsyntax.TokenOQuote || tokens[len(tokens)-1].Type != hclsyntax.TokenCQuote {
+			continue
+		}
+
+		var template strings.Builder
+		for _, token := range tokens[1 : len(tokens)-1] {
+			template.Write(token.Bytes)
+		}
+		if expr := unwrapInterpolationExpression(template.String()); expr != "" {
+			body.SetAttributeRaw(name, hclwrite.Tokens{
+				{Type: hclsyntax.TokenIdent, Bytes: []byte(expr)},
+			})
+		}
+	}
+
+	for _, block := range body.Blocks() {
+		unwrapInterpolations(block.Body())
+	}
+}
+
+// bodyItem is an attribute or block of a body with its tokens, including lead comments
+type bodyItem struct {
+	name     string
+	position int
+	end      int
+	tokens   hclwrite.Tokens
+}
+
+// sortBody orders the attributes and blocks of body and its nested blocks by name, keeping
+// the order of blocks of the same type, and reports whether it changed anything. Blank
+// lines stay where they are between the items, so sorting doesn't change the spacing of a
+// body. Bodies with comments that don't belong to an attribute or block are left in their
+// order, except for the comments the body starts with. At the top level these include the
+// comments of the first item, so a file header stays at the top of the file.
+func sortBody(body *hclwrite.Body, topLevel bool) bool {
+	changed := false
+	for _, block := range body.Blocks() {
+		if sortBody(block.Body(), false) {
+			changed = true
+		}
+	}
+
+	// Items are found in the body by the position of their first token
+	bodyTokens := body.BuildTokens(nil)
+	positions := make(map[*hclwrite.Token]int, len(bodyTokens))
+	for i, token := range bodyTokens {
+		positions[token] = i
+	}
+
+	var items []bodyItem
+	for name, attr := range body.Attributes() {
+		items = append(items, bodyItem{name: name, tokens: attr.BuildTokens(nil)})
+	}
+	for _, block := range body.Blocks() {
+		items = append(items, bodyItem{name: block.Type(), tokens: block.BuildTokens(nil)})
+	}
+
+	itemTokens := 0
+	for i := range items {
+		if len(items[i].tokens) == 0 {
+			return changed
+		}
+		items[i].position = positions[items[i].tokens[0]]
+		items[i].end = positions[items[i].tokens[len(items[i].tokens)-1]] + 1
+		itemTokens += countContentTokens(items[i].tokens)
+	}
+	if len(items) == 0 {
+		return changed
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].position < items[j].position
+	})
+	leading := bodyTokens[:items[0].position]
+	if itemTokens+countContentTokens(leading) != countContentTokens(bodyTokens) {
+		return changed
+	}
+	sorted := sort.SliceIsSorted(items, func(i, j int) bool {
+		return items[i].name < items[j].name
+	})
+	if sorted {
+		return changed
+	}
+
+	if topLevel {
+		comments := 0
+		for comments < len(items[0].tokens) && items[0].tokens[comments].Type == hclsyntax.TokenComment {
+			comments++
+		}
+		leading = bodyTokens[:items[0].position+comments]
+		items[0].tokens = items[0].tokens[comments:]
+	}
+
+	// gaps[i] holds the blank lines after the i-th item, and the last one those after
+	// the last item
+	gaps := make([]hclwrite.Tokens, len(items))
+	for i := range items {
+		next := len(bodyTokens)
+		if i+1 < len(items) {
+			next = items[i+1].position
+		}
+		gaps[i] = blankLines(bodyTokens[items[i].end:next])
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].name < items[j].name
+	})
+	body.Clear()
+	// Block bodies start on the line after their opening brace, the file with its header
+	body.AppendUnstructuredTokens(leading)
+	for i, item := range items {
+		tokens := item.tokens
+		if last := tokens[len(tokens)-1]; !bytes.HasSuffix(last.Bytes, []byte("\n")) {
+			tokens = append(tokens, newlineToken())
+		}
+		body.AppendUnstructuredTokens(tokens)
+		body.AppendUnstructuredTokens(gaps[i])
+	}
+	return true
+}
+
+// blankLines returns the newline tokens of tokens, which separate the items of a body
+func blankLines(tokens hclwrite.Tokens) hclwrite.Tokens {
+	var blank hclwrite.Tokens
+	for _, token := range tokens {
+		if token.Type == hclsyntax.TokenNewline {
+			blank = append(blank, token)
+		}
+	}
+	return blank
+}
+
+// countContentTokens counts the tokens that aren't blank lines
+func countContentTokens(tokens hclwrite.Tokens) int {
+	count := 0
+	for _, token := range tokens {
+		if token.Type != hclsyntax.TokenNewline && token.Type != hclsyntax.TokenEOF {
+			count++
+		}
+	}
+	return count
+}
+
+// unifiedDiff returns the changes from a to b as a unified diff with three lines of context
+func unifiedDiff(filename string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	oldLines := strings.SplitAfter(string(a), "\n")
+	newLines := strings.SplitAfter(string(b), "\n")
+	if oldLines[len(oldLines)-1] == "" {
+		oldLines = oldLines[:len(oldLines)-1]
+	}
+	if newLines[len(newLines)-1] == "" {
+		newLines = newLines[:len(newLines)-1]
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of oldLines[i:] and newLines[j:]
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// ops holds every line prefixed with ' ', '-' or '+'
+	type op struct {
+		kind     byte
+		line     string
+		old, new int
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			ops = append(ops, op{' ', oldLines[i], i, j})
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', oldLines[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{'+', newLines[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", filename, filename)
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		// A hunk runs until the changes are more than twice the context apart
+		first := max(start-context, 0)
+		end := start
+		for k := start; k < len(ops) && k-end <= 2*context; k++ {
+			if ops[k].kind != ' ' {
+				end = k
+			}
+		}
+		last := min(end+context, len(ops)-1)
+
+		oldCount, newCount := 0, 0
+		for _, o := range ops[first : last+1] {
+			if o.kind != '+' {
+				oldCount++
+			}
+			if o.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", ops[first].old+1, oldCount, ops[first].new+1, newCount)
+		for _, o := range ops[first : last+1] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = last + 1
+	}
+	return out.String()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// applyJSONPatch applies an RFC 6902 JSON Patch document to a decoded JSON value
+func applyJSONPatch(doc interface{}, patch []interface{}) (interface{}, error) {
+	for i, rawOp := range patch {
+		op, ok := rawOp.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("patch operation %d is not an object", i)
+		}
+
+		name, _ := op["op"].(string)
+		path, ok := op["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("patch operation %d has no path", i)
+		}
+
+		var err error
+		switch name {
+		case "add":
+			value, ok := op["value"]
+			if !ok {
+				return nil, fmt.Errorf("patch operation %d (add) has no value", i)
+			}
+			doc, err = pointerAdd(doc, path, deepCopyJSON(value))
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "replace":
+			value, ok := op["value"]
+			if !ok {
+				return nil, fmt.Errorf("patch operation %d (replace) has no value", i)
+			}
+			if _, err = pointerGet(doc, path); err == nil {
+				doc, _, err = pointerRemove(doc, path)
+			}
+			if err == nil {
+				doc, err = pointerAdd(doc, path, deepCopyJSON(value))
+			}
+		case "move", "copy":
+			from, ok := op["from"].(string)
+			if !ok {
+				return nil, fmt.Errorf("patch operation %d (%s) has no from", i, name)
+			}
+			var value interface{}
+			if name == "move" {
+				if strings.HasPrefix(path, from+"/") {
+					return nil, fmt.Errorf("patch operation %d (move) cannot move %s into itself", i, from)
+				}
+				doc, value, err = pointerRemove(doc, from)
+			} else {
+				value, err = pointerGet(doc, from)
+				value = deepCopyJSON(value)
+			}
+			if err == nil {
+				doc, err = pointerAdd(doc, path, value)
+			}
+		case "test":
+			var value interface{}
+			value, err = pointerGet(doc, path)
+			if err == nil && !jsonEqual(value, op["value"]) {
+				err = fmt.Errorf("value at %s does not match", path)
+			}
+		default:
+			return nil, fmt.Errorf("patch operation %d has unknown op %q", i, name)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s): %s", i, name, path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// applyMergePatch applies an RFC 7386 JSON Merge Patch document to a decoded JSON value.
+// Because block bodies are wrapped in single element arrays, an object patched onto such
+// an array is merged into its only element instead of replacing the array.
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return deepCopyJSON(patch)
+	}
+
+	if list, ok := target.([]interface{}); ok && len(list) == 1 {
+		if _, isObj := list[0].(map[string]interface{}); isObj {
+			return []interface{}{applyMergePatch(list[0], patch)}
+		}
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = applyMergePatch(targetObj[key], value)
+	}
+
+	return targetObj
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses a reference token as an index into an array of the given length
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > length || (index == length && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+// pointerGet returns the value referenced by pointer
+func pointerGet(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	current := doc
+	for _, token := range tokens {
+		switch typed := current.(type) {
+		case map[string]interface{}:
+			value, ok := typed[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(typed), false)
+			if err != nil {
+				return nil, err
+			}
+			current = typed[index]
+		default:
+			return nil, fmt.Errorf("cannot reference %q in a scalar value", token)
+		}
+	}
+
+	return current, nil
+}
+
+// pointerAdd inserts value at pointer, returning the (possibly replaced) document
+func pointerAdd(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return updateParent(doc, tokens, func(parent interface{}, last string) (interface{}, error) {
+		switch typed := parent.(type) {
+		case map[string]interface{}:
+			typed[last] = value
+			return typed, nil
+		case []interface{}:
+			index, err := arrayIndex(last, len(typed), true)
+			if err != nil {
+				return nil, err
+			}
+			typed = append(typed, nil)
+			copy(typed[index+1:], typed[index:])
+			typed[index] = value
+			return typed, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar value", last)
+		}
+	})
+}
+
+// pointerRemove removes the value at pointer, returning the document and the removed value
+func pointerRemove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed interface{}
+	doc, err = updateParent(doc, tokens, func(parent interface{}, last string) (interface{}, error) {
+		switch typed := parent.(type) {
+		case map[string]interface{}:
+			value, ok := typed[last]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", last)
+			}
+			removed = value
+			delete(typed, last)
+			return typed, nil
+		case []interface{}:
+			index, err := arrayIndex(last, len(typed), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = typed[index]
+			return append(typed[:index], typed[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a scalar value", last)
+		}
+	})
+	return doc, removed, err
+}
+
+// updateParent walks to the parent of the last token and replaces it with the result of fn,
+// which is needed because appending to a slice may reallocate it
+func updateParent(doc interface{}, tokens []string, fn func(parent interface{}, last string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	token := tokens[0]
+	switch typed := doc.(type) {
+	case map[string]interface{}:
+		child, ok := typed[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+		updated, err := updateParent(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		typed[token] = updated
+		return typed, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(typed), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := updateParent(typed[index], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		typed[index] = updated
+		return typed, nil
+	default:
+		return nil, fmt.Errorf("cannot reference %q in a scalar value", token)
+	}
+}
+
+// deepCopyJSON copies a decoded JSON value so patches never alias each other
+func deepCopyJSON(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(typed))
+		for key, elem := range typed {
+			out[key] = deepCopyJSON(elem)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(typed))
+		for i, elem := range typed {
+			out[i] = deepCopyJSON(elem)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// jsonEqual compares decoded JSON values, treating numbers by their exact decimal value
+func jsonEqual(a, b interface{}) bool {
+	switch typedA := a.(type) {
+	case json.Number:
+		typedB, ok := b.(json.Number)
+		return ok && sameNumber(typedA, typedB)
+	case map[string]interface{}:
+		typedB, ok := b.(map[string]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for key, elem := range typedA {
+			other, ok := typedB[key]
+			if !ok || !jsonEqual(elem, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		typedB, ok := b.([]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for i := range typedA {
+			if !jsonEqual(typedA[i], typedB[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// lineLayout controls how lists and objects of attribute values are laid out, set by
+// -max-width and -trailing-commas
+type lineLayout struct {
+	// maxWidth is the line width collections are wrapped at, 0 keeps hclwrite's layout
+	maxWidth int
+	// trailingCommas adds a comma after the last element of wrapped lists
+	trailingCommas bool
+}
+
+// layoutNode is an attribute value, either a list or object literal or any other
+// expression kept as it is
+type layoutNode struct {
+	atom  hclwrite.Tokens
+	open  *hclwrite.Token
+	close *hclwrite.Token
+	items []layoutItem
+}
+
+// layoutItem is an element of a list, or an item of an object with its key
+type layoutItem struct {
+	key   hclwrite.Tokens
+	value *layoutNode
+}
+
+// layoutFile lays out the list and object values of every attribute in file: a collection
+// stays on one line when it fits in maxWidth and has one element per line otherwise
+func layoutFile(file *hclwrite.File, layout lineLayout) {
+	if layout.maxWidth <= 0 {
+		return
+	}
+	layoutBody(file.Body(), 0, layout)
+}
+
+// layoutBody lays out the attributes of body, which is indented by indent columns, and of
+// its nested blocks
+func layoutBody(body *hclwrite.Body, indent int, layout lineLayout) {
+	attrs := body.Attributes()
+	names := make([]string, 0, len(attrs))
+	nameWidth := 0
+	for name := range attrs {
+		names = append(names, name)
+		nameWidth = max(nameWidth, utf8.RuneCountInString(name))
+	}
+	sort.Strings(names)
+
+	// Values start after the aligned equals signs, so they are measured from the longest name
+	column := indent + nameWidth + len(" = ")
+	for _, name := range names {
+		node, ok := parseLayoutNode(attrs[name].Expr().BuildTokens(nil))
+		if !ok || node.atom != nil {
+			continue
+		}
+		body.SetAttributeRaw(name, layout.tokens(node, column, indent, 0))
+	}
+
+	for _, block := range body.Blocks() {
+		layoutBody(block.Body(), indent+2, layout)
+	}
+}
+
+// parseLayoutNode splits the tokens of an expression into nested lists and objects. It
+// fails for expressions it can't lay out without changing them, such as ones with comments
+// or heredocs.
+func parseLayoutNode(tokens hclwrite.Tokens) (*layoutNode, bool) {
+	for _, token := range tokens {
+		switch token.Type {
+		case hclsyntax.TokenComment, hclsyntax.TokenOHeredoc:
+			return nil, false
+		}
+	}
+
+	node, next, ok := parseLayoutValue(tokens, 0)
+	if !ok || next != len(tokens) {
+		return nil, false
+	}
+	return node, true
+}
+
+// parseLayoutValue parses the value starting at tokens[pos], returning the position after it
+func parseLayoutValue(tokens hclwrite.Tokens, pos int) (*layoutNode, int, bool) {
+	if pos >= len(tokens) {
+		return nil, pos, false
+	}
+
+	open := tokens[pos]
+	var closeType hclsyntax.TokenType
+	switch open.Type {
+	case hclsyntax.TokenOBrack:
+		closeType = hclsyntax.TokenCBrack
+	case hclsyntax.TokenOBrace:
+		closeType = hclsyntax.TokenCBrace
+	default:
+		end := skipLayoutAtom(tokens, pos)
+		if end == pos {
+			return nil, pos, false
+		}
+		return &layoutNode{atom: tokens[pos:end]}, end, true
+	}
+
+	// For expressions read like a single value
+	if first := skipLayoutSeparators(tokens, pos+1); first < len(tokens) && isForKeyword(tokens[first]) {
+		end := skipLayoutAtom(tokens, pos)
+		return &layoutNode{atom: tokens[pos:end]}, end, true
+	}
+
+	node := &layoutNode{open: open}
+	pos++
+	for {
+		pos = skipLayoutSeparators(tokens, pos)
+		if pos >= len(tokens) {
+			return nil, pos, false
+		}
+		if tokens[pos].Type == closeType {
+			node.close = tokens[pos]
+			return node, pos + 1, true
+		}
+
+		var item layoutItem
+		if open.Type == hclsyntax.TokenOBrace {
+			keyEnd := skipLayoutAtom(tokens, pos)
+			if keyEnd == pos || keyEnd >= len(tokens) {
+				return nil, pos, false
+			}
+			if separator := tokens[keyEnd].Type; separator != hclsyntax.TokenEqual && separator != hclsyntax.TokenColon {
+				return nil, pos, false
+			}
+			item.key = tokens[pos:keyEnd]
+			pos = keyEnd + 1
+		}
+
+		value, next, ok := parseLayoutValue(tokens, pos)
+		if !ok {
+			return nil, pos, false
+		}
+		if next < len(tokens) {
+			switch tokens[next].Type {
+			case hclsyntax.TokenComma, hclsyntax.TokenNewline, closeType:
+			default:
+				return nil, pos, false
+			}
+		}
+		item.value = value
+		node.items = append(node.items, item)
+		pos = next
+	}
+}
+
+// skipLayoutAtom returns the position after the expression starting at tokens[pos], which
+// ends at a comma, newline, equals sign or closing bracket outside of any nesting
+func skipLayoutAtom(tokens hclwrite.Tokens, pos int) int {
+	depth := 0
+	for ; pos < len(tokens); pos++ {
+		switch tokens[pos].Type {
+		case hclsyntax.TokenOBrack, hclsyntax.TokenOBrace, hclsyntax.TokenOParen,
+			hclsyntax.TokenOQuote, hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			depth++
+		case hclsyntax.TokenCBrack, hclsyntax.TokenCBrace, hclsyntax.TokenCParen,
+			hclsyntax.TokenCQuote, hclsyntax.TokenTemplateSeqEnd:
+			if depth == 0 {
+				return pos
+			}
+			depth--
+		case hclsyntax.TokenComma, hclsyntax.TokenNewline, hclsyntax.TokenEqual, hclsyntax.TokenColon:
+			if depth == 0 {
+				return pos
+			}
+		}
+	}
+	return pos
+}
+
+// skipLayoutSeparators returns the position of the first token from pos that isn't a comma
+// or newline
+func skipLayoutSeparators(tokens hclwrite.Tokens, pos int) int {
+	for pos < len(tokens) && (tokens[pos].Type == hclsyntax.TokenComma || tokens[pos].Type == hclsyntax.TokenNewline) {
+		pos++
+	}
+	return pos
+}
+
+// isForKeyword reports whether token starts a for expression
+func isForKeyword(token *hclwrite.Token) bool {
+	return token.Type == hclsyntax.TokenIdent && string(token.Bytes) == "for"
+}
+
+// tokens returns the tokens of node starting at column of a line indented by indent
+// columns. suffix is the width of what follows node on its line, such as a comma.
+func (l lineLayout) tokens(node *layoutNode, column, indent, suffix int) hclwrite.Tokens {
+	if node.atom != nil {
+		return node.atom
+	}
+	if len(node.items) == 0 || column+flatWidth(node)+suffix <= l.maxWidth {
+		return flatTokens(node)
+	}
+
+	isList := node.open.Type == hclsyntax.TokenOBrack
+	itemColumn := indent + 2
+	if !isList {
+		// Object items are aligned like attributes
+		keyWidth := 0
+		for _, item := range node.items {
+			keyWidth = max(keyWidth, flatTokensWidth(item.key))
+		}
+		itemColumn += keyWidth + len(" = ")
+	}
+
+	tokens := hclwrite.Tokens{node.open, newlineToken()}
+	for i, item := range node.items {
+		if item.key != nil {
+			tokens = append(tokens, item.key...)
+			tokens = append(tokens, equalsToken())
+		}
+
+		comma := isList && (i < len(node.items)-1 || l.trailingCommas)
+		itemSuffix := 0
+		if comma {
+			itemSuffix = 1
+		}
+		tokens = append(tokens, l.tokens(item.value, itemColumn, indent+2, itemSuffix)...)
+		if comma {
+			tokens = append(tokens, commaToken())
+		}
+		tokens = append(tokens, newlineToken())
+	}
+	return append(tokens, node.close)
+}
+
+// flatTokens returns the tokens of node written on a single line
+func flatTokens(node *layoutNode) hclwrite.Tokens {
+	if node.atom != nil {
+		return node.atom
+	}
+
+	tokens := hclwrite.Tokens{node.open}
+	for i, item := range node.items {
+		if i > 0 {
+			tokens = append(tokens, commaToken())
+		}
+		if item.key != nil {
+			tokens = append(tokens, item.key...)
+			tokens = append(tokens, equalsToken())
+		}
+		tokens = append(tokens, flatTokens(item.value)...)
+	}
+	return append(tokens, node.close)
+}
+
+// flatWidth returns the width of node written on a single line
+func flatWidth(node *layoutNode) int {
+	return flatTokensWidth(flatTokens(node))
+}
+
+// flatTokensWidth returns the width of tokens written on a single line, spaced as
+// hclwrite formats them
+func flatTokensWidth(tokens hclwrite.Tokens) int {
+	// Format respaces the tokens, the single spaces only keep them apart
+	spaced := make(hclwrite.Tokens, len(tokens))
+	for i, token := range tokens {
+		copied := *token
+		copied.SpacesBefore = 1
+		spaced[i] = &copied
+	}
+	formatted := strings.TrimSpace(string(hclwrite.Format(spaced.Bytes())))
+	return utf8.RuneCountInString(formatted)
+}
+
+func newlineToken() *hclwrite.Token {
+	return &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")}
+}
+
+func commaToken() *hclwrite.Token {
+	return &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")}
+}
+
+func equalsToken() *hclwrite.Token {
+	return &hclwrite.Token{Type: hclsyntax.TokenEqual, Bytes: []byte("=")}
+}
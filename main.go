@@ -1,21 +1,25 @@
 package main
 
 import (
+	"bytes"
 	stdlibjson "encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
 	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
-	
-	"github.com/kvz/json2hcl/convert"
 	"github.com/zclconf/go-cty/cty"
-	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/kvz/json2hcl/convert"
 )
 
 // VERSION is what is returned by the `-v` flag
@@ -24,12 +28,49 @@ var Version = "development"
 // Global variable to track target file type
 var targetFileType string
 
+// commands are invoked as `json2hcl <command> [flags]`, everything else is a plain conversion
+var commands = map[string]func(args []string) error{
+	"docs":      runDocs,
+	"fmt":       runFmt,
+	"normalize": runNormalize,
+	"patch":     runPatch,
+	"query":     runQuery,
+	"schema":    runSchema,
+	"tfvars":    runTFVarsTemplate,
+	"upgrade":   runUpgrade,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	version := flag.Bool("version", false, "Prints current app version")
 	reverse := flag.Bool("reverse", false, "Input HCL, output JSON")
 	outputFile := flag.String("output", "", "Output file path (used to determine file type for conversion)")
 	treatArraysAsBlocks := flag.Bool("treat-arrays-as-blocks", false, "Convert JSON arrays to separate HCL blocks (e.g., variables, resources)")
 	keepArraysNested := flag.Bool("keep-arrays-nested", false, "Keep JSON arrays as nested structures (e.g., for .tfvars format)")
+	jsonStyle := flag.String("json-style", "nested", "With -reverse, nested (labels as object keys) or ordered (every body as a list of attributes and blocks in source order)")
+	flattenBlocks := flag.Bool("flatten-blocks", false, "With -reverse, write blocks that are the only one with their type and labels as an object instead of a single-element array")
+	blockTypes := flag.String("block-types", "", "Comma separated keys that are always blocks, each optionally with its label count (e.g. lifecycle,provisioner:1), for reading -flatten-blocks JSON")
+	specFile := flag.String("spec", "", "hcldec spec file describing the attributes and blocks of the configuration, used instead of the Terraform rules in both directions")
+	blockList := flag.Bool("block-list", false, "With -reverse, write every block as an ordered {type, labels, body} entry of \""+convert.BlockListKey+"\"")
+	splitDir := flag.String("split-dir", "", "Write blocks into per-concern files (versions.tf, providers.tf, variables.tf, ...) inside this directory")
+	splitMap := flag.String("split-map", "", "Comma separated block type[.label prefix]=file overrides for -split-dir (e.g. resource.aws_iam_=iam.tf)")
+	mergeFile := flag.String("merge", "", "Upsert generated blocks and attributes into this existing HCL file, keeping all other content")
+	variablesOut := flag.String("variables-out", "", "Also write variable declarations with types inferred from the JSON values to this file (e.g. variables.tf)")
+	variablesDefaults := flag.Bool("variables-defaults", false, "Use the JSON values as defaults in the -variables-out declarations")
+	variablesDescriptions := flag.String("variables-descriptions", "", "JSON object file mapping variable names to descriptions for -variables-out")
+	explain := flag.String("explain", "", "Print why each JSON key became a block or an attribute to stderr, as text or json")
+	maxWidth := flag.Int("max-width", 0, "Keep lists and objects on one line when they fit in this many columns and write one element per line otherwise, 0 keeps the default layout")
+	trailingCommas := flag.Bool("trailing-commas", false, "With -max-width, end every element of a wrapped list with a comma, including the last")
+	variablesCheck := flag.String("variables", "", "Comma separated module .tf files or directories whose variable declarations the tfvars input is checked and converted against")
 	flag.Parse()
 	if *version {
 		fmt.Println(Version)
@@ -41,23 +82,78 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Error: Cannot use both --treat-arrays-as-blocks and --keep-arrays-nested flags together")
 		os.Exit(1)
 	}
-	
+
 	if *treatArraysAsBlocks {
 		targetFileType = "terraform"
 	} else if *keepArraysNested {
 		targetFileType = "tfvars"
 	} else if *outputFile != "" {
 		targetFileType = getFileType(*outputFile)
+	} else if *mergeFile != "" {
+		targetFileType = getFileType(*mergeFile)
 	} else {
 		// Default to terraform format for backward compatibility
 		targetFileType = "terraform"
 	}
 
 	var err error
+	declaredBlockTypes, err = parseBlockTypes(*blockTypes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *specFile != "" {
+		spec, err := loadSpec(*specFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		bodySpec = convert.NewSpec(spec)
+	}
+
+	if *explain != "" {
+		if *explain != "text" && *explain != "json" {
+			fmt.Fprintf(os.Stderr, "unknown -explain format %q, expected text or json\n", *explain)
+			os.Exit(1)
+		}
+		if *reverse {
+			fmt.Fprintln(os.Stderr, "-explain only applies to JSON to HCL conversion")
+			os.Exit(1)
+		}
+		explainer = newDecisionLog()
+	}
+
+	if *maxWidth < 0 {
+		fmt.Fprintln(os.Stderr, "-max-width must not be negative")
+		os.Exit(1)
+	}
+	if *trailingCommas && *maxWidth == 0 {
+		fmt.Fprintln(os.Stderr, "-trailing-commas requires -max-width")
+		os.Exit(1)
+	}
+
 	if *reverse {
-		err = toJSON()
+		switch *jsonStyle {
+		case "nested", "ordered":
+			err = toJSON(convert.Options{BlockList: *blockList, Ordered: *jsonStyle == "ordered", FlattenBlocks: *flattenBlocks, Terraform: targetFileType == "terraform", Spec: bodySpec})
+		default:
+			err = fmt.Errorf("unknown -json-style %q, expected nested or ordered", *jsonStyle)
+		}
 	} else {
-		err = toHCL()
+		err = toHCL(hclOutput{
+			splitDir:  *splitDir,
+			splitMap:  *splitMap,
+			mergeFile: *mergeFile,
+
+			variablesOut:          *variablesOut,
+			variablesDefaults:     *variablesDefaults,
+			variablesDescriptions: *variablesDescriptions,
+			variablesCheck:        *variablesCheck,
+
+			explain: *explain,
+			layout:  lineLayout{maxWidth: *maxWidth, trailingCommas: *trailingCommas},
+		})
 	}
 
 	if err != nil {
@@ -80,77 +176,215 @@ func getFileType(filename string) string {
 	}
 }
 
-func toJSON() error {
+func toJSON(options convert.Options) error {
 	input, err := io.ReadAll(os.Stdin)
 	if err != nil {
 		return fmt.Errorf("unable to read from stdin: %s", err)
 	}
 
 	// Use the convert package to convert HCL to JSON
-	jsonBytes, err := convert.Bytes(input, "<stdin>", convert.Options{})
+	jsonBytes, err := convert.Bytes(input, "<stdin>", options)
 	if err != nil {
 		return fmt.Errorf("unable to convert HCL to JSON: %s", err)
 	}
 
-	// Pretty print the JSON
-	var jsonData interface{}
-	if err := stdlibjson.Unmarshal(jsonBytes, &jsonData); err != nil {
-		return fmt.Errorf("unable to parse JSON for formatting: %s", err)
-	}
-
-	prettyJSON, err := stdlibjson.MarshalIndent(jsonData, "", "  ")
-	if err != nil {
+	// Pretty print the JSON, keeping the source order convert wrote it in
+	var prettyJSON bytes.Buffer
+	if err := stdlibjson.Indent(&prettyJSON, jsonBytes, "", "  "); err != nil {
 		return fmt.Errorf("unable to format JSON: %s", err)
 	}
 
-	fmt.Println(string(prettyJSON))
+	fmt.Println(prettyJSON.String())
 	return nil
 }
 
-func toHCL() error {
+// hclOutput describes where toHCL sends the generated HCL, stdout when empty
+type hclOutput struct {
+	splitDir  string
+	splitMap  string
+	mergeFile string
+
+	// variablesOut additionally receives inferred variable declarations
+	variablesOut          string
+	variablesDefaults     bool
+	variablesDescriptions string
+
+	// variablesCheck lists module files whose variable declarations the input must satisfy
+	variablesCheck string
+
+	// explain is the format decisions are printed to stderr in, see explainer
+	explain string
+
+	// layout is how lists and objects are wrapped
+	layout lineLayout
+}
+
+func toHCL(output hclOutput) error {
 	input, err := io.ReadAll(os.Stdin)
 	if err != nil {
 		return fmt.Errorf("unable to read from stdin: %s", err)
 	}
 
+	if output.variablesCheck != "" {
+		input, err = checkTFVarsAgainst(input, output.variablesCheck)
+		if err != nil {
+			return err
+		}
+	}
+
+	nativeFile, err := jsonToNativeFile(input, "<stdin>")
+	if err != nil {
+		return err
+	}
+	layoutFile(nativeFile, output.layout)
+
+	if explainer != nil {
+		if err := explainer.write(os.Stderr, output.explain); err != nil {
+			return err
+		}
+	}
+
+	if output.splitDir != "" && output.mergeFile != "" {
+		return fmt.Errorf("cannot use -split-dir and -merge together")
+	}
+
+	if output.variablesOut != "" {
+		err := writeVariableDeclarations(output.variablesOut, input, output.variablesDefaults, output.variablesDescriptions)
+		if err != nil {
+			return err
+		}
+	}
+
+	if output.splitDir != "" {
+		rules, err := parseSplitMap(output.splitMap)
+		if err != nil {
+			return err
+		}
+		return writeSplitFiles(output.splitDir, splitNativeFile(nativeFile, rules))
+	}
+
+	if output.mergeFile != "" {
+		return mergeIntoFile(output.mergeFile, nativeFile)
+	}
+
+	// Output the formatted HCL
+	fmt.Print(string(nativeFile.Bytes()))
+	return nil
+}
+
+// jsonToNativeFile parses HCL JSON and converts it into a native syntax hclwrite file
+func jsonToNativeFile(input []byte, filename string) (*hclwrite.File, error) {
+	// The ordered JSON style is a list of attributes and blocks rather than an object
+	if trimmed := bytes.TrimSpace(input); len(trimmed) > 0 && trimmed[0] == '[' {
+		items, err := decodeJSON(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse JSON: %s", err)
+		}
+		nativeFile := hclwrite.NewEmptyFile()
+		if err := convertOrderedBody(items, nativeFile.Body()); err != nil {
+			return nil, fmt.Errorf("unable to convert to native HCL: %s", err)
+		}
+		if targetFileType == "terraform" {
+			bareReferences(nativeFile.Body(), "")
+			bareTypeConstraints(nativeFile.Body(), "")
+		}
+		return nativeFile, nil
+	}
+
+	if bodySpec != nil {
+		return specJSONToNativeFile(input, filename)
+	}
+
+	// Bring Terraform JSON into the one shape the block conversion below expects
+	if targetFileType == "terraform" {
+		normalized, err := normalizeTerraformJSON(input, declaredBlockTypes)
+		if err != nil {
+			return nil, err
+		}
+		input = normalized
+	}
+
 	// Use hclparse for JSON parsing - this handles JSON->HCL conversion natively
 	parser := hclparse.NewParser()
-	file, diags := parser.ParseJSON(input, "<stdin>")
+	file, diags := parser.ParseJSON(input, filename)
 	if diags.HasErrors() {
-		return fmt.Errorf("unable to parse JSON: %s", diags.Error())
+		return nil, fmt.Errorf("unable to parse JSON: %s", diags.Error())
+	}
+
+	// The decoded JSON keeps the text of numbers, which the parsed values lose
+	literals, err := decodeJSON(input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON: %s", err)
 	}
+	topLevel, _ := literals.(map[string]interface{})
 
 	// Convert to native HCL syntax using hclwrite
 	nativeFile := hclwrite.NewEmptyFile()
-	err = convertToNativeHCL(file.Body, nativeFile.Body())
+	err = convertToNativeHCL(file.Body, topLevel, nativeFile.Body())
 	if err != nil {
-		return fmt.Errorf("unable to convert to native HCL: %s", err)
+		return nil, fmt.Errorf("unable to convert to native HCL: %s", err)
+	}
+	if targetFileType == "terraform" {
+		bareReferences(nativeFile.Body(), "")
+		bareTypeConstraints(nativeFile.Body(), "")
 	}
 
-	// Output the formatted HCL
-	fmt.Print(string(nativeFile.Bytes()))
-	return nil
+	return nativeFile, nil
 }
 
-func convertToNativeHCL(jsonBody hcl.Body, nativeBody *hclwrite.Body) error {
+// convertToNativeHCL converts a parsed HCL JSON body. literals is the same body decoded by
+// decodeJSON, if available, and gives numbers their original text.
+func convertToNativeHCL(jsonBody hcl.Body, literals map[string]interface{}, nativeBody *hclwrite.Body) error {
 	// Get all attributes first to check if this is a block body or attribute body
 	attrs, diags := jsonBody.JustAttributes()
-	if !diags.HasErrors() {
-		// This body only contains attributes, process them
+	if _, isBlockList := attrs[convert.BlockListKey]; isBlockList && !diags.HasErrors() {
+		content := make(map[string]cty.Value)
 		for name, attr := range attrs {
+			val, valDiags := attr.Expr.Value(nil)
+			if valDiags.HasErrors() {
+				continue
+			}
+			content[name] = withNumberLiterals(val, literals[name])
+		}
+		if err := checkBodyKeys(content, "", nil); err != nil {
+			return err
+		}
+		return convertBlockListBody(content, terraformJSONSchema, nativeBody)
+	}
+	if !diags.HasErrors() {
+		// This body only contains attributes, process them in a stable order
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if err := checkName(name, "", nil); err != nil {
+				return err
+			}
+
+			attr := attrs[name]
 			val, valDiags := attr.Expr.Value(nil)
 			if valDiags.HasErrors() {
 				// If we can't evaluate, skip it (handles expressions)
 				continue
 			}
-			
+			val = withNumberLiterals(val, literals[name])
+
 			// Check if this attribute represents an HCL JSON block structure
+			var decision blockDecision
 			if val.Type().IsListType() || val.Type().IsTupleType() {
 				// Check if this looks like a block array (array of objects with nested structure)
 				// vs a regular attribute array (simple array of objects/values)
-				if isHCLBlockArray(name, val) {
-					if err := convertJSONBlockArray(name, val, nativeBody); err != nil {
+				if decision = blockArrayDecision(name, nil, val); decision.block {
+					schema := terraformBlockSchema(terraformJSONSchema, name)
+					if err := convertBlocksOrRollback(nativeBody, func() error { return convertJSONBlockArray(name, schema, val, nativeBody) }); err != nil {
+						if mustBeBlock(decision, err) {
+							return err
+						}
 						// If block conversion fails, treat as regular attribute
+						decision = fallbackDecision(err)
 						setAttributeWithExpressionHandling(nativeBody, name, val)
 					}
 				} else {
@@ -159,17 +393,24 @@ func convertToNativeHCL(jsonBody hcl.Body, nativeBody *hclwrite.Body) error {
 				}
 			} else if val.Type().IsObjectType() {
 				// Check if this object should be converted to blocks (like variable definitions in .tf files)
-				if shouldConvertObjectToBlocks(name, val) {
-					if err := convertObjectToBlocks(name, val, nativeBody); err != nil {
+				if decision = objectBlocksDecision(name, val); decision.block {
+					schema := terraformBlockSchema(terraformJSONSchema, name)
+					if err := convertBlocksOrRollback(nativeBody, func() error { return convertObjectToBlocks(name, schema, val, nativeBody) }); err != nil {
+						if mustBeBlock(decision, err) {
+							return err
+						}
 						// If block conversion fails, treat as regular attribute
+						decision = fallbackDecision(err)
 						setAttributeWithExpressionHandling(nativeBody, name, val)
 					}
 				} else {
 					setAttributeWithExpressionHandling(nativeBody, name, val)
 				}
 			} else {
+				decision = attributeBecause(reasonValueShape, "not an object or array")
 				setAttributeWithExpressionHandling(nativeBody, name, val)
 			}
+			explainDecision(nativeBody, name, decision)
 		}
 		return nil
 	}
@@ -191,8 +432,8 @@ func convertToNativeHCL(jsonBody hcl.Body, nativeBody *hclwrite.Body) error {
 
 	// Process blocks recursively
 	for _, block := range content.Blocks {
-		nativeBlock := nativeBody.AppendNewBlock(block.Type, block.Labels)
-		err := convertToNativeHCL(block.Body, nativeBlock.Body())
+		nativeBlock := appendBlock(nativeBody, block.Type, block.Labels)
+		err := convertToNativeHCL(block.Body, nil, nativeBlock.Body())
 		if err != nil {
 			return err
 		}
@@ -205,16 +446,7 @@ func setAttributeWithExpressionHandling(body *hclwrite.Body, name string, val ct
 	// Check if this is a special case where we need unquoted literals
 	if val.Type() == cty.String {
 		strVal := val.AsString()
-		
-		// Handle type attributes that should be unquoted
-		if name == "type" && isUnquotedType(strVal) {
-			// Set as an unquoted identifier
-			body.SetAttributeRaw(name, hclwrite.Tokens{
-				{Type: hclsyntax.TokenIdent, Bytes: []byte(strVal)},
-			})
-			return
-		}
-		
+
 		if expr := unwrapInterpolationExpression(strVal); expr != "" {
 			// Set as a raw expression instead of a string value
 			body.SetAttributeRaw(name, hclwrite.Tokens{
@@ -222,19 +454,78 @@ func setAttributeWithExpressionHandling(body *hclwrite.Body, name string, val ct
 			})
 			return
 		}
-		
+
 		// Check if this string contains interpolations that need special handling
 		if strings.Contains(strVal, "${") {
-			// This is a template string with interpolations - use raw tokens to avoid escaping
+			// This is a template string with interpolations - use raw tokens to keep the
+			// template sequences, escaping only the literal text around them
 			body.SetAttributeRaw(name, hclwrite.Tokens{
-				{Type: hclsyntax.TokenQuotedLit, Bytes: []byte(`"` + strVal + `"`)},
+				{Type: hclsyntax.TokenOQuote, Bytes: []byte(`"`)},
+				{Type: hclsyntax.TokenQuotedLit, Bytes: []byte(escapeTemplateLiteral(strVal))},
+				{Type: hclsyntax.TokenCQuote, Bytes: []byte(`"`)},
 			})
 			return
 		}
 	}
-	
+
 	// Regular attribute value
-	body.SetAttributeValue(name, val)
+	body.SetAttributeRaw(name, valueTokens(val))
+}
+
+// escapeTemplateLiteral escapes the quotes, backslashes and control characters in the
+// literal text of a template for a quoted native string. The ${ and %{ sequences are
+// copied as they are, since their expressions may contain quoted strings themselves.
+func escapeTemplateLiteral(template string) string {
+	var out strings.Builder
+	for i := 0; i < len(template); i++ {
+		rest := template[i:]
+		switch {
+		case strings.HasPrefix(rest, "$${") || strings.HasPrefix(rest, "%%{"):
+			out.WriteString(rest[:3])
+			i += 2
+		case strings.HasPrefix(rest, "${") || strings.HasPrefix(rest, "%{"):
+			end := templateSequenceEnd(template, i+2)
+			out.WriteString(template[i:end])
+			i = end - 1
+		case rest[0] == '\\':
+			out.WriteString(`\\`)
+		case rest[0] == '"':
+			out.WriteString(`\"`)
+		case rest[0] == '\n':
+			out.WriteString(`\n`)
+		case rest[0] == '\r':
+			out.WriteString(`\r`)
+		case rest[0] == '\t':
+			out.WriteString(`\t`)
+		default:
+			out.WriteByte(rest[0])
+		}
+	}
+	return out.String()
+}
+
+// templateSequenceEnd returns the index just past the brace closing the template sequence
+// whose expression starts at start, skipping braces in nested objects and quoted strings
+func templateSequenceEnd(template string, start int) int {
+	depth := 1
+	inString := false
+	for i := start; i < len(template); i++ {
+		switch c := template[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(template)
 }
 
 // isUnquotedType checks if a type value should be unquoted
@@ -253,6 +544,41 @@ func isUnquotedType(str string) bool {
 	return unquotedTypes[str]
 }
 
+// bareTypeConstraints rewrites the type constraints of the variable blocks in body, a
+// blockType block, and its nested blocks, like type = "list(string)", to the bare type
+// expressions native syntax requires
+func bareTypeConstraints(body *hclwrite.Body, blockType string) {
+	if attr := body.GetAttribute("type"); attr != nil && blockType == "variable" {
+		tokens := attr.Expr().BuildTokens(nil)
+		unquoted := unquoteTypeTokens(tokens, func(from, to string) {})
+		if !tokensEqual(unquoted, tokens) {
+			body.SetAttributeRaw("type", unquoted)
+		}
+	}
+
+	for _, block := range body.Blocks() {
+		bareTypeConstraints(block.Body(), block.Type())
+	}
+}
+
+// typeConstraintTokens returns the native syntax tokens of a Terraform type constraint
+// expression, or false if str isn't one
+func typeConstraintTokens(str string) (hclwrite.Tokens, bool) {
+	expr, diags := hclsyntax.ParseExpression([]byte(str), "<type>", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, false
+	}
+	if _, _, diags := typeexpr.TypeConstraintWithDefaults(expr); diags.HasErrors() {
+		return nil, false
+	}
+
+	tokens, err := expressionTokens(str)
+	if err != nil {
+		return nil, false
+	}
+	return tokens, true
+}
+
 func unwrapInterpolationExpression(str string) string {
 	// Check if this is a simple interpolation expression like "${var.name}"
 	if len(str) > 3 && str[0:2] == "${" && str[len(str)-1:] == "}" {
@@ -269,8 +595,8 @@ func isSimpleReference(expr string) bool {
 	// Simple heuristic: contains only alphanumeric, dots, underscores, and hyphens
 	// This matches patterns like: var.name, aws_instance.foo.id, etc.
 	for _, r := range expr {
-		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || 
-			 r == '.' || r == '_' || r == '-') {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+			r == '.' || r == '_' || r == '-') {
 			return false
 		}
 	}
@@ -285,66 +611,80 @@ func unescapeInterpolations(str string) string {
 	return str
 }
 
-// isHCLBlockArray determines if an array should be treated as HCL blocks vs a regular attribute
-func isHCLBlockArray(name string, val cty.Value) bool {
+// blockArrayDecision determines if an array should be treated as HCL blocks vs a regular attribute.
+// nested is the schema of name when it is a block type Terraform defines in the enclosing block.
+func blockArrayDecision(name string, nested *jsonBlockSchema, val cty.Value) blockDecision {
 	// Only check arrays/lists
 	if !val.Type().IsListType() && !val.Type().IsTupleType() {
-		return false
+		return attributeBecause(reasonValueShape, "not an array")
 	}
-	
+
 	// Empty arrays are not block arrays
 	if val.LengthInt() == 0 {
-		return false
+		return attributeBecause(reasonValueShape, "empty array")
 	}
-	
+
 	// Check for known HCL block types that should be treated as blocks
 	hclBlockTypes := map[string]bool{
-		"resource":                true,
-		"data":                    true,
-		"provider":                true,
-		"output":                  true,
-		"locals":                  true,
-		"module":                  true,
-		"terraform":               true,
-		"attribute":               true,
-		"global_secondary_index":  true,
-		"local_secondary_index":   true,
-		"backup_policy":           true,
-		"point_in_time_recovery":  true,
-		"server_side_encryption":  true,
-		"stream_specification":    true,
-		"ttl":                     true,
-	}
-	
+		"resource":               true,
+		"data":                   true,
+		"provider":               true,
+		"output":                 true,
+		"locals":                 true,
+		"module":                 true,
+		"provisioner":            true,
+		"terraform":              true,
+		"attribute":              true,
+		"global_secondary_index": true,
+		"local_secondary_index":  true,
+		"backup_policy":          true,
+		"point_in_time_recovery": true,
+		"server_side_encryption": true,
+		"stream_specification":   true,
+		"ttl":                    true,
+	}
+
 	// Special handling for variables based on target file type
 	if name == "variable" {
 		// For .tf files, variables should be separate blocks
 		// For .tfvars files, variables should be nested attributes
-		return targetFileType == "terraform"
+		if targetFileType == "terraform" {
+			return blockBecause(reasonKnownBlock, "variable is a Terraform block type")
+		}
+		return attributeBecause(reasonTFVars, "variable is an attribute in .tfvars files")
 	}
-	
+
 	// If this is a known HCL block type, treat it as a block array
+	if _, declared := declaredBlockTypes[name]; declared {
+		return blockBecause(reasonDeclared, name+" is given with -block-types")
+	}
 	if hclBlockTypes[name] {
-		return true
+		return blockBecause(reasonKnownBlock, name+" is a known block type")
 	}
-	
+
+	// Blocks nested in Terraform blocks, such as lifecycle or validation, always hold
+	// an array of bodies once the input is normalized
+	if nested != nil && isObjectArray(val) {
+		return blockBecause(reasonKnownBlock, name+" is a block type nested in Terraform blocks")
+	}
+
 	// Get the first element to inspect its structure
 	firstElemIt := val.ElementIterator()
 	firstElemIt.Next()
 	_, firstElem := firstElemIt.Element()
-	
+
 	if !firstElem.Type().IsObjectType() {
 		// If elements aren't objects, this is definitely not a block array
-		return false
+		return attributeBecause(reasonValueShape, "array elements are not objects")
 	}
-	
+
 	firstElemMap := firstElem.AsValueMap()
-	
+
 	// HCL JSON block arrays have a very specific nested structure:
 	// "resource": [{"aws_instance": [{"name": [{...actual content...}]}]}]
 	// Regular attribute arrays have a flat structure:
 	// "subnets": [{"name": "value", "other": "value"}, ...]
-	
+
 	// Check if this has the nested block structure
 	if len(firstElemMap) == 1 {
 		for _, value := range firstElemMap {
@@ -354,26 +694,28 @@ func isHCLBlockArray(name string, val cty.Value) bool {
 					valueElemIt := value.ElementIterator()
 					valueElemIt.Next()
 					_, valueFirstElem := valueElemIt.Element()
-					
+
 					if valueFirstElem.Type().IsObjectType() {
 						valueFirstElemMap := valueFirstElem.AsValueMap()
 						// If there's another level of nesting with labels, it's likely a block structure
 						if len(valueFirstElemMap) == 1 {
 							// This looks like a labeled block structure
-							return true
+							return blockBecause(reasonStructure, "array of single-key objects nesting another single-key object, like labeled blocks")
 						}
 					}
 				}
 			}
 		}
 	}
-	
+
 	// For regular attribute arrays like subnets, security_groups, etc.,
 	// these should be treated as regular attributes, not blocks
-	return false
+	return attributeBecause(reasonStructure, "array of objects without the nested label structure of blocks")
 }
 
-func convertJSONBlockArray(blockType string, val cty.Value, nativeBody *hclwrite.Body) error {
+// convertJSONBlockArray converts an HCL JSON block array of blockType, whose schema is nil
+// unless Terraform defines the block type where it appears
+func convertJSONBlockArray(blockType string, schema *jsonBlockSchema, val cty.Value, nativeBody *hclwrite.Body) error {
 	// Check if this is an array/list of objects (HCL JSON block format)
 	if !val.Type().IsListType() && !val.Type().IsTupleType() {
 		return fmt.Errorf("not a block array")
@@ -382,30 +724,54 @@ func convertJSONBlockArray(blockType string, val cty.Value, nativeBody *hclwrite
 	// Iterate through each block instance in the array
 	for it := val.ElementIterator(); it.Next(); {
 		_, blockInstance := it.Element()
-		
+
 		if !blockInstance.Type().IsObjectType() {
 			return fmt.Errorf("block instance is not an object")
 		}
 
-		// Extract block labels and content
-		labels, blockContent, err := extractBlockLabelsAndContent(blockInstance)
-		if err != nil {
-			return err
-		}
+		// Extract block labels and content, one label path can hold several blocks
+		for _, instance := range extractBlockInstances(blockType, schema, nil, blockInstance) {
+			if err := checkBodyKeys(instance.content, blockType, instance.labels); err != nil {
+				return err
+			}
+
+			// Create the native HCL block
+			nativeBlock := appendBlock(nativeBody, blockType, instance.labels)
+			if _, isBlockList := instance.content[convert.BlockListKey]; isBlockList {
+				if err := convertBlockListBody(instance.content, schema, nativeBlock.Body()); err != nil {
+					return err
+				}
+				continue
+			}
 
-		// Create the native HCL block
-		nativeBlock := nativeBody.AppendNewBlock(blockType, labels)
-		
-		// Add attributes to the block
-		for attrName, attrVal := range blockContent {
-			// Handle nested block arrays recursively
-			if attrVal.Type().IsListType() || attrVal.Type().IsTupleType() {
-				if err := convertJSONBlockArray(attrName, attrVal, nativeBlock.Body()); err != nil {
-					// If it's not a nested block array, treat as regular attribute
+			// Add attributes to the block
+			for _, attrName := range sortedValueKeys(instance.content) {
+				attrVal := instance.content[attrName]
+				nested := terraformBlockSchema(schema, attrName)
+				var decision blockDecision
+				if closedBlockBody(schema, attrName) && (isObjectArray(attrVal) || attrVal.Type().IsObjectType()) {
+					decision = attributeBecause(reasonKnownBlock, "Terraform defines no "+attrName+" block here")
+					setAttributeWithExpressionHandling(nativeBlock.Body(), attrName, attrVal)
+				} else if isObjectArray(attrVal) {
+					// Handle nested block arrays recursively
+					decision = blockBecause(reasonStructure, "arrays inside block array bodies are nested blocks when they convert")
+					if err := convertBlocksOrRollback(nativeBlock.Body(), func() error { return convertJSONBlockArray(attrName, nested, attrVal, nativeBlock.Body()) }); err != nil {
+						// If it's not a nested block array, treat as regular attribute
+						decision = fallbackDecision(err)
+						setAttributeWithExpressionHandling(nativeBlock.Body(), attrName, attrVal)
+					}
+				} else if decision = nestedObjectDecision(attrName, attrVal); decision.block {
+					if err := convertBlocksOrRollback(nativeBlock.Body(), func() error { return convertObjectToBlocks(attrName, nested, attrVal, nativeBlock.Body()) }); err != nil {
+						if mustBeBlock(decision, err) {
+							return err
+						}
+						decision = fallbackDecision(err)
+						setAttributeWithExpressionHandling(nativeBlock.Body(), attrName, attrVal)
+					}
+				} else {
 					setAttributeWithExpressionHandling(nativeBlock.Body(), attrName, attrVal)
 				}
-			} else {
-				setAttributeWithExpressionHandling(nativeBlock.Body(), attrName, attrVal)
+				explainDecision(nativeBlock.Body(), attrName, decision)
 			}
 		}
 	}
@@ -413,81 +779,195 @@ func convertJSONBlockArray(blockType string, val cty.Value, nativeBody *hclwrite
 	return nil
 }
 
-func extractBlockLabelsAndContent(blockInstance cty.Value) ([]string, map[string]cty.Value, error) {
-	labels := []string{}
-	content := make(map[string]cty.Value)
-	
-	// Iterate through the object attributes
+// jsonBlockInstance is a single block found in an HCL JSON block array
+type jsonBlockInstance struct {
+	labels  []string
+	content map[string]cty.Value
+}
+
+// blockLabelCounts is the number of labels taken by well-known Terraform block types,
+// which tells labels apart from body content in HCL JSON
+var blockLabelCounts = map[string]int{
+	"data":        2,
+	"locals":      0,
+	"module":      1,
+	"output":      1,
+	"provider":    1,
+	"provisioner": 1,
+	"resource":    2,
+	"terraform":   0,
+	"variable":    1,
+}
+
+// declaredBlockTypes are block types given with -block-types and their number of labels.
+// Keys of these types are always converted to blocks, also when they hold a single object
+// rather than an array, as written by -reverse -flatten-blocks.
+var declaredBlockTypes = map[string]int{}
+
+// blockLabelCount returns the number of labels of a block type, if known. schema is the
+// schema of the block type where Terraform defines it, or nil.
+func blockLabelCount(blockType string, schema *jsonBlockSchema) (int, bool) {
+	if count, declared := declaredBlockTypes[blockType]; declared {
+		return count, true
+	}
+	if count, known := blockLabelCounts[blockType]; known {
+		return count, true
+	}
+	if schema != nil {
+		return schema.labels, true
+	}
+	return 0, false
+}
+
+// terraformBlockSchema returns the schema of the blockType blocks nested in a block of the
+// parent schema, or nil when Terraform doesn't define blockType there
+func terraformBlockSchema(parent *jsonBlockSchema, blockType string) *jsonBlockSchema {
+	if parent == nil || targetFileType != "terraform" {
+		return nil
+	}
+	return parent.blocks[blockType]
+}
+
+// closedBlockBody reports whether name can't be a nested block in a body of the given schema,
+// because Terraform defines every nested block of that body, like locals or lifecycle, and
+// name is neither one of them nor declared with -block-types
+func closedBlockBody(schema *jsonBlockSchema, name string) bool {
+	if schema == nil || schema.providerBlocks {
+		return false
+	}
+	if _, declared := declaredBlockTypes[name]; declared {
+		return false
+	}
+	_, defined := schema.blocks[name]
+	return !defined
+}
+
+// parseBlockTypes parses a comma separated list of block types, each optionally followed by
+// its number of labels, e.g. "lifecycle,ebs_block_device,provisioner:1"
+func parseBlockTypes(spec string) (map[string]int, error) {
+	blockTypes := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, count := entry, 0
+		if i := strings.Index(entry, ":"); i >= 0 {
+			var err error
+			name = entry[:i]
+			count, err = strconv.Atoi(entry[i+1:])
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("invalid label count in block type %q", entry)
+			}
+		}
+		if !hclsyntax.ValidIdentifier(name) {
+			return nil, fmt.Errorf("invalid block type %q", name)
+		}
+		blockTypes[name] = count
+	}
+	return blockTypes, nil
+}
+
+// maxGuessedLabels limits how many labels are guessed for block types not in blockLabelCounts
+const maxGuessedLabels = 2
+
+// extractBlockInstances returns the blocks held by one element of an HCL JSON block array.
+// In HCL JSON, labeled blocks are nested as:
+// "resource": [{"aws_instance": [{"my-instance": [{...actual content...}]}]}]
+// and every label level may hold an array with several objects, e.g. provider aliases:
+// "provider": [{"aws": [{...}, {"alias": "west", ...}]}]
+// Each of those becomes a separate block, in the original order.
+func extractBlockInstances(blockType string, schema *jsonBlockSchema, labels []string, blockInstance cty.Value) []jsonBlockInstance {
 	blockMap := blockInstance.AsValueMap()
-	
-	// In HCL JSON format, labeled blocks are nested as:
-	// "resource": [{"aws_instance": [{"my-instance": [{...actual content...}]}]}]
-	// We need to extract the labels from the nested structure
-	
-	// If there's only one key at the top level, it might be a label
-	if len(blockMap) == 1 {
-		for key, value := range blockMap {
-			// Check if this is a list with a single element that's also a single-key object
-			if value.Type().IsListType() || value.Type().IsTupleType() {
-				if value.LengthInt() == 1 {
-					elemIt := value.ElementIterator()
-					elemIt.Next()
-					_, firstElem := elemIt.Element()
-					
-					if firstElem.Type().IsObjectType() {
-						firstElemMap := firstElem.AsValueMap()
-						if len(firstElemMap) == 1 {
-							// This looks like another nested label
-							for innerKey, innerValue := range firstElemMap {
-								labels = append(labels, key, innerKey)
-								if innerValue.Type().IsListType() || innerValue.Type().IsTupleType() {
-									if innerValue.LengthInt() == 1 {
-										innerElemIt := innerValue.ElementIterator()
-										innerElemIt.Next()
-										_, innerFirstElem := innerElemIt.Element()
-										if innerFirstElem.Type().IsObjectType() {
-											content = innerFirstElem.AsValueMap()
-											return labels, content, nil
-										}
-									}
-								}
-								// If it's not a nested structure, use it as content
-								content[innerKey] = innerValue
-								return labels[:1], content, nil // Only first label
-							}
-						} else {
-							// This is the content with the first key as label
-							labels = append(labels, key)
-							content = firstElemMap
-							return labels, content, nil
-						}
-					}
-				} else {
-					// Multiple elements in the array - this could be multiple instances
-					// of the same block type, treat as regular content
-					content[key] = value
-					return labels, content, nil
-				}
-			} else {
-				// If it's not a list structure, treat as regular content
-				content[key] = value
+	count, known := blockLabelCount(blockType, schema)
+
+	// Every key is a label of a block type with a known label count, like the keys of
+	// "dynamic": [{"egress": ..., "ingress": ...}]. Otherwise only a single key can be a label.
+	if len(blockMap) == 0 || (!known && len(blockMap) > 1) {
+		return []jsonBlockInstance{{labels: labels, content: blockMap}}
+	}
+	if (known && len(labels) >= count) || (!known && len(labels) >= maxGuessedLabels) {
+		return []jsonBlockInstance{{labels: labels, content: blockMap}}
+	}
+
+	var instances []jsonBlockInstance
+	for _, key := range sortedValueKeys(blockMap) {
+		value := blockMap[key]
+		var elems []cty.Value
+		if isObjectArray(value) {
+			for it := value.ElementIterator(); it.Next(); {
+				_, elem := it.Element()
+				elems = append(elems, elem)
 			}
+		} else if known && value.Type().IsObjectType() {
+			elems = []cty.Value{value}
 		}
-	} else {
-		// Multiple keys at top level - treat all as regular content
-		content = blockMap
+		if elems == nil {
+			return []jsonBlockInstance{{labels: labels, content: blockMap}}
+		}
+
+		nestedLabels := append(append([]string{}, labels...), key)
+		for _, elem := range elems {
+			instances = append(instances, extractBlockInstances(blockType, schema, nestedLabels, elem)...)
+		}
+	}
+	return instances
+}
+
+// isObjectArray reports whether val is a non-empty array holding only objects
+func isObjectArray(val cty.Value) bool {
+	if !val.Type().IsListType() && !val.Type().IsTupleType() {
+		return false
+	}
+	if val.LengthInt() == 0 {
+		return false
 	}
-	
-	return labels, content, nil
+	for it := val.ElementIterator(); it.Next(); {
+		if _, elem := it.Element(); !elem.Type().IsObjectType() {
+			return false
+		}
+	}
+	return true
 }
 
-// shouldConvertObjectToBlocks determines if an object should be converted to separate blocks
-func shouldConvertObjectToBlocks(name string, val cty.Value) bool {
+// nestedObjectDecision determines whether an object inside a block body holds nested blocks
+// rather than a map, like "provisioner": {"local-exec": [{...}, {...}]} or a block type
+// declared with -block-types
+func nestedObjectDecision(name string, val cty.Value) blockDecision {
+	if !val.Type().IsObjectType() {
+		return attributeBecause(reasonValueShape, "not an object or array")
+	}
+	if _, declared := declaredBlockTypes[name]; declared {
+		return blockBecause(reasonDeclared, name+" is given with -block-types")
+	}
+	if name == "provisioner" && targetFileType == "terraform" {
+		return blockBecause(reasonKnownBlock, "provisioner objects hold blocks labeled by provisioner type")
+	}
+	return attributeBecause(reasonValueShape, "object inside a block body is a map")
+}
+
+// sortedValueKeys returns the keys of an object value map in a stable order
+func sortedValueKeys(values map[string]cty.Value) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// objectBlocksDecision determines if an object should be converted to separate blocks
+func objectBlocksDecision(name string, val cty.Value) blockDecision {
 	// Only check objects
 	if !val.Type().IsObjectType() {
-		return false
+		return attributeBecause(reasonValueShape, "not an object")
 	}
-	
+
+	if _, declared := declaredBlockTypes[name]; declared {
+		return blockBecause(reasonDeclared, name+" is given with -block-types")
+	}
+
 	// For .tf files, certain object types should be converted to separate blocks
 	if targetFileType == "terraform" {
 		blockTypes := map[string]bool{
@@ -500,95 +980,278 @@ func shouldConvertObjectToBlocks(name string, val cty.Value) bool {
 			"module":    true,
 			"terraform": true,
 		}
-		return blockTypes[name]
+		if blockTypes[name] {
+			return blockBecause(reasonKnownBlock, name+" is a top-level Terraform block type")
+		}
+		return attributeBecause(reasonValueShape, "object that isn't a top-level Terraform block type")
 	}
-	
-	return false
+
+	return attributeBecause(reasonTFVars, "objects are maps in .tfvars files")
 }
 
-// convertObjectToBlocks converts an object to separate blocks
-func convertObjectToBlocks(blockType string, val cty.Value, nativeBody *hclwrite.Body) error {
+// convertObjectToBlocks converts an object to separate blocks of blockType, whose schema is
+// nil unless Terraform defines the block type where it appears
+func convertObjectToBlocks(blockType string, schema *jsonBlockSchema, val cty.Value, nativeBody *hclwrite.Body) error {
 	if !val.Type().IsObjectType() {
 		return fmt.Errorf("not an object")
 	}
-	
+
+	if _, known := blockLabelCount(blockType, schema); known {
+		return convertObjectToBlocksRecursive(blockType, schema, nil, val, nativeBody)
+	}
+
 	// Iterate through each key-value pair in the object
-	for key, value := range val.AsValueMap() {
-		if err := convertObjectToBlocksRecursive(blockType, []string{key}, value, nativeBody); err != nil {
+	for _, key := range sortedValueKeys(val.AsValueMap()) {
+		if err := convertObjectToBlocksRecursive(blockType, schema, []string{key}, val.GetAttr(key), nativeBody); err != nil {
 			return err
 		}
 	}
-	
+
 	return nil
 }
 
 // convertObjectToBlocksRecursive handles nested block structures
-func convertObjectToBlocksRecursive(blockType string, labels []string, val cty.Value, nativeBody *hclwrite.Body) error {
-	// Handle case where value is an array with a single object (HCL JSON format)
+func convertObjectToBlocksRecursive(blockType string, schema *jsonBlockSchema, labels []string, val cty.Value, nativeBody *hclwrite.Body) error {
+	count, known := blockLabelCount(blockType, schema)
+
+	// Handle case where value is an array of objects (HCL JSON format). Every element is a
+	// separate block with the same labels, e.g. several aliased provider "aws" blocks.
 	if val.Type().IsListType() || val.Type().IsTupleType() {
-		if val.LengthInt() == 1 {
-			// Get the first (and only) element
-			elemIt := val.ElementIterator()
-			elemIt.Next()
-			_, firstElem := elemIt.Element()
-			
-			if firstElem.Type().IsObjectType() {
-				// Create the native HCL block with all collected labels
-				nativeBlock := nativeBody.AppendNewBlock(blockType, labels)
-				
-				// Add attributes to the block, handling nested blocks recursively
-				for attrName, attrVal := range firstElem.AsValueMap() {
-					if attrVal.Type().IsListType() || attrVal.Type().IsTupleType() {
-						// Check if this is a nested block array
-						if isHCLBlockArray(attrName, attrVal) {
-							if err := convertJSONBlockArray(attrName, attrVal, nativeBlock.Body()); err != nil {
-								setAttributeWithExpressionHandling(nativeBlock.Body(), attrName, attrVal)
-							}
-						} else {
-							setAttributeWithExpressionHandling(nativeBlock.Body(), attrName, attrVal)
-						}
-					} else {
-						setAttributeWithExpressionHandling(nativeBlock.Body(), attrName, attrVal)
-					}
+		if !isObjectArray(val) {
+			return fmt.Errorf("expected array of objects for block %s.%s", blockType, strings.Join(labels, "."))
+		}
+
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			if known && len(labels) < count {
+				// Arrays are allowed at any label level
+				if err := convertObjectToBlocksRecursive(blockType, schema, labels, elem, nativeBody); err != nil {
+					return err
 				}
-				return nil
-			} else {
-				return fmt.Errorf("expected object in array for block %s.%s", blockType, strings.Join(labels, "."))
+				continue
+			}
+			if err := appendObjectBlock(blockType, schema, labels, elem.AsValueMap(), nativeBody); err != nil {
+				return err
 			}
-		} else {
-			return fmt.Errorf("expected single element array for block %s.%s", blockType, strings.Join(labels, "."))
 		}
+		return nil
 	} else if val.Type().IsObjectType() {
-		// Check if this is another level of nested structure (like resource.aws_instance.name)
-		// If all values in the object are arrays/lists, it's likely another level of nesting
 		valueMap := val.AsValueMap()
-		allArrays := true
-		for _, v := range valueMap {
-			if !v.Type().IsListType() && !v.Type().IsTupleType() {
-				allArrays = false
-				break
+
+		// Check if this is another level of nested structure (like resource.aws_instance.name).
+		// Without a known label count, an object whose values are all arrays is likely another
+		// level of nesting.
+		moreLabels := known && len(labels) < count
+		if !known && len(valueMap) > 0 {
+			moreLabels = true
+			for _, v := range valueMap {
+				if !v.Type().IsListType() && !v.Type().IsTupleType() {
+					moreLabels = false
+					break
+				}
 			}
 		}
-		
-		if allArrays && len(valueMap) > 0 {
+
+		if moreLabels {
 			// This is another level of nesting, recurse deeper
-			for nestedKey, nestedValue := range valueMap {
-				newLabels := append(labels, nestedKey)
-				if err := convertObjectToBlocksRecursive(blockType, newLabels, nestedValue, nativeBody); err != nil {
+			for _, nestedKey := range sortedValueKeys(valueMap) {
+				newLabels := append(append([]string{}, labels...), nestedKey)
+				if err := convertObjectToBlocksRecursive(blockType, schema, newLabels, valueMap[nestedKey], nativeBody); err != nil {
 					return err
 				}
 			}
 			return nil
-		} else {
-			// Direct object content - create block with current labels
-			nativeBlock := nativeBody.AppendNewBlock(blockType, labels)
-			for attrName, attrVal := range valueMap {
-				setAttributeWithExpressionHandling(nativeBlock.Body(), attrName, attrVal)
-			}
-			return nil
 		}
+
+		// Direct object content - create block with current labels
+		return appendObjectBlock(blockType, schema, labels, valueMap, nativeBody)
 	} else {
 		return fmt.Errorf("unexpected value type for block %s.%s", blockType, strings.Join(labels, "."))
 	}
 }
 
+// appendObjectBlock creates a block with the given labels, handling nested blocks in its body
+func appendObjectBlock(blockType string, schema *jsonBlockSchema, labels []string, content map[string]cty.Value, nativeBody *hclwrite.Body) error {
+	if err := checkBodyKeys(content, blockType, labels); err != nil {
+		return err
+	}
+	nativeBlock := appendBlock(nativeBody, blockType, labels)
+	return convertObjectBody(content, schema, nativeBlock.Body())
+}
+
+// convertObjectBody converts the content of an HCL JSON block body, of a block with the given
+// schema when Terraform defines it
+func convertObjectBody(content map[string]cty.Value, schema *jsonBlockSchema, nativeBody *hclwrite.Body) error {
+	if _, isBlockList := content[convert.BlockListKey]; isBlockList {
+		return convertBlockListBody(content, schema, nativeBody)
+	}
+
+	for _, attrName := range sortedValueKeys(content) {
+		attrVal := content[attrName]
+		nested := terraformBlockSchema(schema, attrName)
+		var decision blockDecision
+		if closedBlockBody(schema, attrName) && (isObjectArray(attrVal) || attrVal.Type().IsObjectType()) {
+			decision = attributeBecause(reasonKnownBlock, "Terraform defines no "+attrName+" block here")
+			setAttributeWithExpressionHandling(nativeBody, attrName, attrVal)
+		} else if attrVal.Type().IsListType() || attrVal.Type().IsTupleType() {
+			// Check if this is a nested block array
+			if decision = blockArrayDecision(attrName, nested, attrVal); decision.block {
+				if err := convertBlocksOrRollback(nativeBody, func() error { return convertJSONBlockArray(attrName, nested, attrVal, nativeBody) }); err != nil {
+					if mustBeBlock(decision, err) {
+						return err
+					}
+					decision = fallbackDecision(err)
+					setAttributeWithExpressionHandling(nativeBody, attrName, attrVal)
+				}
+			} else {
+				setAttributeWithExpressionHandling(nativeBody, attrName, attrVal)
+			}
+		} else if decision = nestedObjectDecision(attrName, attrVal); decision.block {
+			if err := convertBlocksOrRollback(nativeBody, func() error { return convertObjectToBlocks(attrName, nested, attrVal, nativeBody) }); err != nil {
+				if mustBeBlock(decision, err) {
+					return err
+				}
+				decision = fallbackDecision(err)
+				setAttributeWithExpressionHandling(nativeBody, attrName, attrVal)
+			}
+		} else {
+			setAttributeWithExpressionHandling(nativeBody, attrName, attrVal)
+		}
+		explainDecision(nativeBody, attrName, decision)
+	}
+	return nil
+}
+
+// convertBlockListBody converts a body written with the block list encoding of hcl2json, where
+// every block is an entry of convert.BlockListKey and all other keys are plain attributes.
+// schema is the schema of the block the body belongs to when Terraform defines it.
+func convertBlockListBody(content map[string]cty.Value, schema *jsonBlockSchema, nativeBody *hclwrite.Body) error {
+	for _, name := range sortedValueKeys(content) {
+		if name != convert.BlockListKey {
+			setAttributeWithExpressionHandling(nativeBody, name, content[name])
+			explainDecision(nativeBody, name, attributeBecause(reasonEncoding, "keys beside "+convert.BlockListKey+" are attributes"))
+		}
+	}
+
+	blocks := content[convert.BlockListKey]
+	if !blocks.Type().IsListType() && !blocks.Type().IsTupleType() {
+		return fmt.Errorf("%s must be an array of blocks", convert.BlockListKey)
+	}
+	explainDecision(nativeBody, convert.BlockListKey, blockBecause(reasonEncoding, convert.BlockListKey+" entries are blocks"))
+
+	for it := blocks.ElementIterator(); it.Next(); {
+		index, entry := it.Element()
+		blockType, labels, body, err := blockListEntry(entry)
+		if err != nil {
+			return fmt.Errorf("invalid %s entry %s: %s", convert.BlockListKey, index.AsBigFloat().Text('f', -1), err)
+		}
+		if err := checkName(blockType, convert.BlockListKey, nil); err != nil {
+			return err
+		}
+		if err := checkBodyKeys(body, blockType, labels); err != nil {
+			return err
+		}
+
+		nativeBlock := appendBlock(nativeBody, blockType, labels)
+		if err := convertObjectBody(body, terraformBlockSchema(schema, blockType), nativeBlock.Body()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertOrderedBody converts a body written in the ordered JSON style of hcl2json, a list of
+// {"name": ..., "value": ...} attributes and {"type": ..., "labels": [...], "body": [...]} blocks
+func convertOrderedBody(body interface{}, nativeBody *hclwrite.Body) error {
+	items, ok := body.([]interface{})
+	if !ok {
+		return fmt.Errorf("an ordered body must be an array")
+	}
+
+	for i, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("body item %d must be an object", i)
+		}
+
+		if name, ok := entry["name"].(string); ok {
+			if !hclsyntax.ValidIdentifier(name) {
+				return fmt.Errorf("attribute name %q is not a valid identifier", name)
+			}
+			val, err := jsonToCty(entry["value"])
+			if err != nil {
+				return fmt.Errorf("attribute %q: %s", name, err)
+			}
+			val = withNumberLiterals(val, entry["value"])
+			setAttributeWithExpressionHandling(nativeBody, name, val)
+			explainDecision(nativeBody, name, attributeBecause(reasonEncoding, "ordered entries with a name are attributes"))
+			continue
+		}
+
+		blockType, ok := entry["type"].(string)
+		if !ok {
+			return fmt.Errorf("body item %d must have a name or a type", i)
+		}
+		if !hclsyntax.ValidIdentifier(blockType) {
+			return fmt.Errorf("block type %q is not a valid identifier", blockType)
+		}
+		var labels []string
+		if rawLabels, ok := entry["labels"].([]interface{}); ok {
+			for _, rawLabel := range rawLabels {
+				label, ok := rawLabel.(string)
+				if !ok {
+					return fmt.Errorf("labels of %s block must be strings", blockType)
+				}
+				labels = append(labels, label)
+			}
+		}
+
+		explainDecision(nativeBody, blockType, blockBecause(reasonEncoding, "ordered entries with a type are blocks"))
+		nativeBlock := appendBlock(nativeBody, blockType, labels)
+		blockBody, ok := entry["body"]
+		if !ok || blockBody == nil {
+			continue
+		}
+		if err := convertOrderedBody(blockBody, nativeBlock.Body()); err != nil {
+			return fmt.Errorf("%s block: %s", blockType, err)
+		}
+	}
+	return nil
+}
+
+// blockListEntry reads a {"type": ..., "labels": [...], "body": {...}} block list entry
+func blockListEntry(entry cty.Value) (string, []string, map[string]cty.Value, error) {
+	if !entry.Type().IsObjectType() || entry.IsNull() {
+		return "", nil, nil, fmt.Errorf("expected an object")
+	}
+	attrs := entry.AsValueMap()
+
+	blockType, ok := attrs["type"]
+	if !ok || !blockType.Type().Equals(cty.String) || blockType.IsNull() {
+		return "", nil, nil, fmt.Errorf("type must be a string")
+	}
+
+	var labels []string
+	if labelsVal, ok := attrs["labels"]; ok && !labelsVal.IsNull() {
+		if !labelsVal.Type().IsListType() && !labelsVal.Type().IsTupleType() {
+			return "", nil, nil, fmt.Errorf("labels must be an array of strings")
+		}
+		for it := labelsVal.ElementIterator(); it.Next(); {
+			_, label := it.Element()
+			if !label.Type().Equals(cty.String) || label.IsNull() {
+				return "", nil, nil, fmt.Errorf("labels must be an array of strings")
+			}
+			labels = append(labels, label.AsString())
+		}
+	}
+
+	body := map[string]cty.Value{}
+	if bodyVal, ok := attrs["body"]; ok && !bodyVal.IsNull() {
+		if !bodyVal.Type().IsObjectType() {
+			return "", nil, nil, fmt.Errorf("body must be an object")
+		}
+		body = bodyVal.AsValueMap()
+	}
+
+	return blockType.AsString(), labels, body, nil
+}
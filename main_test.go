@@ -9,12 +9,18 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
 	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+
+	"github.com/kvz/json2hcl/convert"
 )
 
 // ConversionTest represents a single conversion test case
@@ -361,7 +367,7 @@ func runConversionTest(t *testing.T, test ConversionTest) {
 	}
 
 	// Prepare command arguments
-	args := []string{"run", "main.go"}
+	args := []string{"run", "."}
 	args = append(args, test.flags...)
 
 	// Run the command
@@ -456,6 +462,102 @@ func TestConversions(t *testing.T) {
 			outputFile: "fixtures/deeply-nested.tfvars",
 			flags:      []string{},
 		},
+		{
+			name:       "JSON to HCL (type constraints)",
+			inputFile:  "fixtures/type-constraints.tf.json",
+			outputFile: "fixtures/type-constraints.tf",
+			flags:      []string{},
+		},
+		{
+			name:       "HCL to JSON (type constraints reverse)",
+			inputFile:  "fixtures/type-constraints.tf",
+			outputFile: "fixtures/type-constraints.tf.json",
+			flags:      []string{"-reverse"},
+		},
+		{
+			name:       "JSON to HCL (repeated blocks)",
+			inputFile:  "fixtures/repeated-blocks.tf.json",
+			outputFile: "fixtures/repeated-blocks.tf",
+			flags:      []string{},
+		},
+		{
+			name:       "HCL to JSON (repeated blocks reverse)",
+			inputFile:  "fixtures/repeated-blocks.tf",
+			outputFile: "fixtures/repeated-blocks.tf.json",
+			flags:      []string{"-reverse"},
+		},
+		{
+			name:       "JSON to HCL (mixed labeled and unlabeled blocks)",
+			inputFile:  "fixtures/mixed-blocks.tf.json",
+			outputFile: "fixtures/mixed-blocks.tf",
+			flags:      []string{},
+		},
+		{
+			name:       "HCL to JSON (mixed labeled and unlabeled blocks reverse)",
+			inputFile:  "fixtures/mixed-blocks.tf",
+			outputFile: "fixtures/mixed-blocks.tf.json",
+			flags:      []string{"-reverse"},
+		},
+		{
+			name:       "JSON to HCL (lifecycle blocks)",
+			inputFile:  "fixtures/lifecycle.tf.json",
+			outputFile: "fixtures/lifecycle.tf",
+			flags:      []string{},
+		},
+		{
+			name:       "HCL to JSON (lifecycle blocks reverse)",
+			inputFile:  "fixtures/lifecycle.tf",
+			outputFile: "fixtures/lifecycle.tf.json",
+			flags:      []string{"-reverse"},
+		},
+		{
+			name:       "JSON to HCL (dynamic blocks)",
+			inputFile:  "fixtures/dynamic.tf.json",
+			outputFile: "fixtures/dynamic.tf",
+			flags:      []string{},
+		},
+		{
+			name:       "HCL to JSON (dynamic blocks reverse)",
+			inputFile:  "fixtures/dynamic.tf",
+			outputFile: "fixtures/dynamic.tf.json",
+			flags:      []string{"-reverse"},
+		},
+		{
+			name:       "JSON to HCL (provisioners)",
+			inputFile:  "fixtures/provisioner.tf.json",
+			outputFile: "fixtures/provisioner.tf",
+			flags:      []string{},
+		},
+		{
+			name:       "HCL to JSON (provisioners reverse)",
+			inputFile:  "fixtures/provisioner.tf",
+			outputFile: "fixtures/provisioner.tf.json",
+			flags:      []string{"-reverse"},
+		},
+		{
+			name:       "JSON to HCL (backend block)",
+			inputFile:  "fixtures/backend.tf.json",
+			outputFile: "fixtures/backend.tf",
+			flags:      []string{},
+		},
+		{
+			name:       "HCL to JSON (backend block reverse)",
+			inputFile:  "fixtures/backend.tf",
+			outputFile: "fixtures/backend.tf.json",
+			flags:      []string{"-reverse"},
+		},
+		{
+			name:       "JSON to HCL (required providers)",
+			inputFile:  "fixtures/required-providers.tf.json",
+			outputFile: "fixtures/required-providers.tf",
+			flags:      []string{},
+		},
+		{
+			name:       "HCL to JSON (required providers reverse)",
+			inputFile:  "fixtures/required-providers.tf",
+			outputFile: "fixtures/required-providers.tf.json",
+			flags:      []string{"-reverse"},
+		},
 		{
 			name:       "JSON to tfvars (large arrays)",
 			inputFile:  "fixtures/large-array.tfvars.json",
@@ -767,4 +869,1726 @@ func validateHCLJSONStaticAnalysis(t *testing.T, filename string, file *hcl.File
 			}
 		}
 	}
-} 
\ No newline at end of file
+}
+
+func TestSplitOutput(t *testing.T) {
+	input, err := os.ReadFile("fixtures/infra.tf.json")
+	if err != nil {
+		t.Fatalf("Failed to read input file: %v", err)
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command("go", "run", ".", "-split-dir", dir, "-split-map", "resource.aws_dynamodb_=dynamodb.tf")
+	cmd.Stdin = bytes.NewReader(input)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, out)
+	}
+
+	expected := map[string]string{
+		"providers.tf": `provider "aws"`,
+		"variables.tf": `variable "FREY_DO_TOKEN"`,
+		"outputs.tf":   `output "arn"`,
+		"dynamodb.tf":  `resource "aws_dynamodb_table" "basic-dynamodb-table"`,
+	}
+	for filename, header := range expected {
+		content, err := os.ReadFile(filepath.Join(dir, filename))
+		if err != nil {
+			t.Errorf("Expected %s to be written: %v", filename, err)
+			continue
+		}
+		if !strings.Contains(string(content), header) {
+			t.Errorf("Expected %s to contain %q, got:\n%s", filename, header, content)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "main.tf")); !os.IsNotExist(err) {
+		t.Errorf("Expected no main.tf when every block is routed elsewhere")
+	}
+}
+
+func TestBlockListRoundTrip(t *testing.T) {
+	targetFileType = "terraform"
+	input := `widget {
+  size = 1
+}
+widget "named" {
+  size = 2
+}
+resource "aws_security_group" "sg" {
+  name = "sg"
+  dynamic "ingress" {
+    for_each = var.ports
+    content {
+      from_port = ingress.value
+    }
+  }
+  ingress {
+    from_port = 22
+  }
+}
+`
+	if _, err := convert.Bytes([]byte(input), "mixed.tf", convert.Options{}); err != nil {
+		t.Fatalf("Mixed blocks should fall back to the block list encoding: %v", err)
+	}
+
+	jsonBytes, err := convert.Bytes([]byte(input), "mixed.tf", convert.Options{BlockList: true})
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	nativeFile, err := jsonToNativeFile(jsonBytes, "mixed.tf.json")
+	if err != nil {
+		t.Fatalf("Failed to convert back to HCL: %v", err)
+	}
+	if actual := string(nativeFile.Bytes()); actual != input {
+		t.Errorf("Block list did not round trip:\n%s\nexpected:\n%s", actual, input)
+	}
+
+	_, err = jsonToNativeFile([]byte(`{"__blocks": [{"labels": ["x"]}]}`), "invalid.tf.json")
+	if err == nil || !strings.Contains(err.Error(), "type must be a string") {
+		t.Errorf("Expected an error for a block list entry without type, got %v", err)
+	}
+}
+
+func TestOrderedJSONRoundTrip(t *testing.T) {
+	targetFileType = "terraform"
+	input := `terraform {
+  required_version = ">= 1.0"
+}
+resource "null_resource" "b" {
+  triggers = {
+    id = "static"
+  }
+  provisioner "local-exec" {
+    command = "echo first"
+  }
+  provisioner "remote-exec" {
+    inline = ["echo second"]
+  }
+  provisioner "local-exec" {
+    command = "echo ${var.id}"
+  }
+}
+variable "id" {
+  type = string
+}
+resource "null_resource" "a" {
+  count = 2
+}
+`
+	jsonBytes, err := convert.Bytes([]byte(input), "ordered.tf", convert.Options{Ordered: true})
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+
+	var items []map[string]interface{}
+	if err := json.Unmarshal(jsonBytes, &items); err != nil {
+		t.Fatalf("Ordered JSON should be an array of body items: %v\n%s", err, jsonBytes)
+	}
+	var types []string
+	for _, item := range items {
+		types = append(types, item["type"].(string))
+	}
+	if strings.Join(types, ",") != "terraform,resource,variable,resource" {
+		t.Errorf("Blocks are not in source order: %v", types)
+	}
+
+	nativeFile, err := jsonToNativeFile(jsonBytes, "ordered.tf.json")
+	if err != nil {
+		t.Fatalf("Failed to convert back to HCL: %v", err)
+	}
+	if actual := string(nativeFile.Bytes()); actual != input {
+		t.Errorf("Ordered JSON did not round trip:\n%s\nexpected:\n%s", actual, input)
+	}
+
+	if _, err := jsonToNativeFile([]byte(`[{"labels": []}]`), "invalid.tf.json"); err == nil {
+		t.Errorf("Expected an error for a body item without name or type")
+	}
+}
+
+func TestReverseSourceOrder(t *testing.T) {
+	input := `terraform {
+  required_version = ">= 1.0"
+}
+variable "zone" {
+  type = string
+}
+resource "aws_instance" "web" {
+  tags = {
+    Name = "web"
+    Env  = "prod"
+  }
+  ami = "ami-1"
+}
+variable "app" {}
+locals {
+  z = 1
+  a = 2
+}
+`
+	jsonBytes, err := convert.Bytes([]byte(input), "order.tf", convert.Options{})
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+
+	expected := `{"terraform":[{"required_version":">= 1.0"}],` +
+		`"variable":{"zone":[{"type":"string"}],"app":[{}]},` +
+		`"resource":{"aws_instance":{"web":[{"tags":{"Name":"web","Env":"prod"},"ami":"ami-1"}]}},` +
+		`"locals":[{"z":1,"a":2}]}`
+	if string(jsonBytes) != expected {
+		t.Errorf("JSON is not in source order:\n%s\nexpected:\n%s", jsonBytes, expected)
+	}
+
+	// ConvertFile keeps returning plain maps, ConvertFileOrdered has the source order
+	file, diags := hclparse.NewParser().ParseHCL([]byte(input), "order.tf")
+	if diags.HasErrors() {
+		t.Fatalf("Failed to parse: %s", diags.Error())
+	}
+	converted, err := convert.ConvertFile(file, convert.Options{})
+	if err != nil {
+		t.Fatalf("Failed to convert file: %v", err)
+	}
+	locals, ok := converted["locals"].([]interface{})
+	if !ok || len(locals) != 1 || !reflect.DeepEqual(locals[0], map[string]interface{}{"z": json.RawMessage("1"), "a": json.RawMessage("2")}) {
+		t.Errorf("Expected plain maps from ConvertFile, got %#v", converted["locals"])
+	}
+	ordered, err := convert.ConvertFileOrdered(file, convert.Options{})
+	if err != nil {
+		t.Fatalf("Failed to convert file: %v", err)
+	}
+	if keys := ordered.Keys(); strings.Join(keys, ",") != "terraform,variable,resource,locals" {
+		t.Errorf("Expected keys in source order, got %v", keys)
+	}
+}
+
+func TestFlattenBlocks(t *testing.T) {
+	targetFileType = "terraform"
+	input := `resource "aws_instance" "web" {
+  ami = "ami-1"
+  ebs_block_device {
+    device_name = "/dev/sdb"
+  }
+  ebs_block_device {
+    device_name = "/dev/sdc"
+  }
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+`
+	jsonBytes, err := convert.Bytes([]byte(input), "flat.tf", convert.Options{FlattenBlocks: true})
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+
+	expected := `{"resource":{"aws_instance":{"web":{"ami":"ami-1",` +
+		`"ebs_block_device":[{"device_name":"/dev/sdb"},{"device_name":"/dev/sdc"}],` +
+		`"lifecycle":{"create_before_destroy":true}}}}}`
+	if string(jsonBytes) != expected {
+		t.Errorf("Unexpected flattened JSON:\n%s\nexpected:\n%s", jsonBytes, expected)
+	}
+
+	declaredBlockTypes, err = parseBlockTypes("lifecycle, ebs_block_device")
+	if err != nil {
+		t.Fatalf("Failed to parse block types: %v", err)
+	}
+	defer func() { declaredBlockTypes = map[string]int{} }()
+
+	nativeFile, err := jsonToNativeFile(jsonBytes, "flat.tf.json")
+	if err != nil {
+		t.Fatalf("Failed to convert back to HCL: %v", err)
+	}
+	if actual := string(nativeFile.Bytes()); actual != input {
+		t.Errorf("Flattened JSON did not round trip:\n%s\nexpected:\n%s", actual, input)
+	}
+
+	if _, err := parseBlockTypes("provisioner:x"); err == nil {
+		t.Errorf("Expected an error for an invalid label count")
+	}
+}
+
+func TestNormalizeTerraformJSON(t *testing.T) {
+	shapes := []string{
+		`{"resource": {"aws_instance": {"web": [{"ami": "a", "lifecycle": [{"prevent_destroy": true}]}]}}, "provider": {"aws": [{"region": "eu"}, {"alias": "us"}]}}`,
+		`{"resource": {"aws_instance": {"web": {"ami": "a", "lifecycle": {"prevent_destroy": true}}}}, "provider": [{"aws": {"region": "eu"}}, {"aws": {"alias": "us"}}]}`,
+		`{"resource": [{"aws_instance": [{"web": [{"ami": "a", "lifecycle": {"prevent_destroy": true}}]}]}], "provider": {"aws": [{"region": "eu"}, {"alias": "us"}]}}`,
+	}
+	expected := `{"provider":{"aws":[{"region":"eu"},{"alias":"us"}]},` +
+		`"resource":{"aws_instance":{"web":[{"ami":"a","lifecycle":[{"prevent_destroy":true}]}]}}}`
+
+	for i, shape := range shapes {
+		normalized, err := normalizeTerraformJSON([]byte(shape), nil)
+		if err != nil {
+			t.Fatalf("Shape %d: failed to normalize: %v", i, err)
+		}
+		if string(normalized) != expected {
+			t.Errorf("Shape %d: unexpected normalized JSON:\n%s\nexpected:\n%s", i, normalized, expected)
+		}
+	}
+
+	// Unknown keys are left as they are unless declared as blocks
+	input := `{"resource": {"aws_instance": {"web": {"tags": {"a": "b"}, "ebs": {"size": 1}}}}}`
+	normalized, err := normalizeTerraformJSON([]byte(input), map[string]int{"ebs": 0})
+	if err != nil {
+		t.Fatalf("Failed to normalize: %v", err)
+	}
+	if want := `{"resource":{"aws_instance":{"web":[{"ebs":[{"size":1}],"tags":{"a":"b"}}]}}}`; string(normalized) != want {
+		t.Errorf("Unexpected normalized JSON:\n%s\nexpected:\n%s", normalized, want)
+	}
+
+	// Nested labeled blocks keep their order
+	input = `{"resource": {"null_resource": {"a": {"provisioner": [{"remote-exec": {"inline": []}}, {"file": {"source": "x"}}], "dynamic": {"ingress": {"for_each": []}}}}}}`
+	normalized, err = normalizeTerraformJSON([]byte(input), nil)
+	if err != nil {
+		t.Fatalf("Failed to normalize: %v", err)
+	}
+	if want := `{"resource":{"null_resource":{"a":[{"dynamic":[{"ingress":[{"for_each":[]}]}],` +
+		`"provisioner":[{"remote-exec":[{"inline":[]}]},{"file":[{"source":"x"}]}]}]}}}`; string(normalized) != want {
+		t.Errorf("Unexpected normalized JSON:\n%s\nexpected:\n%s", normalized, want)
+	}
+
+	if _, err := normalizeTerraformJSON([]byte(`["not", "an", "object"]`), nil); err == nil {
+		t.Errorf("Expected an error for a non-object document")
+	}
+}
+
+func TestSpecConversion(t *testing.T) {
+	specPath := filepath.Join(t.TempDir(), "app.hcldec")
+	spec := `object {
+  attr "name" {
+    type = string
+  }
+  attr "port" {
+    type = number
+  }
+  block_map "listener" {
+    labels = ["protocol"]
+    object {
+      attr "enabled" {
+        type = bool
+      }
+      block_list "rule" {
+        object {
+          attr "path" {
+            type = string
+          }
+        }
+      }
+    }
+  }
+}
+`
+	if err := os.WriteFile(specPath, []byte(spec), 0644); err != nil {
+		t.Fatalf("Failed to write spec: %v", err)
+	}
+	loaded, err := loadSpec(specPath)
+	if err != nil {
+		t.Fatalf("Failed to load spec: %v", err)
+	}
+	bodySpec = convert.NewSpec(loaded)
+	defer func() { bodySpec = nil }()
+
+	// The spec decides the label count, so "listener" isn't guessed to be an attribute
+	input := `{"name": "web", "port": "8080", "listener": {"http": {"enabled": "true", "rule": [{"path": "/"}, {"path": "/api"}]}}}`
+	nativeFile, err := jsonToNativeFile([]byte(input), "app.json")
+	if err != nil {
+		t.Fatalf("Failed to convert to HCL: %v", err)
+	}
+	expected := `listener "http" {
+  enabled = true
+  rule {
+    path = "/"
+  }
+  rule {
+    path = "/api"
+  }
+}
+name = "web"
+port = 8080
+`
+	if actual := string(nativeFile.Bytes()); actual != expected {
+		t.Errorf("Unexpected HCL:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	jsonBytes, err := convert.Bytes([]byte("name = 5\nport = \"81\"\nlistener \"http\" {\n  enabled = \"false\"\n}\n"), "app.hcl", convert.Options{Spec: bodySpec})
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	if want := `{"name":"5","port":81,"listener":{"http":[{"enabled":false}]}}`; string(jsonBytes) != want {
+		t.Errorf("Unexpected JSON:\n%s\nexpected:\n%s", jsonBytes, want)
+	}
+
+	if _, err := convert.Bytes([]byte("listener {\n}\n"), "app.hcl", convert.Options{Spec: bodySpec}); err == nil {
+		t.Errorf("Expected an error for a block with the wrong number of labels")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	targetFileType = "terraform"
+	input := `{"locals": ["not a body"], "resource": {"aws_instance": {"web": {"ami": "a", "lifecycle": {"prevent_destroy": true}}}}, "subnets": [{"name": "a"}]}`
+
+	plain, err := jsonToNativeFile([]byte(input), "explain.json")
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+
+	explainer = newDecisionLog()
+	defer func() { explainer = nil }()
+	explained, err := jsonToNativeFile([]byte(input), "explain.json")
+	if err != nil {
+		t.Fatalf("Failed to convert with -explain: %v", err)
+	}
+	if string(explained.Bytes()) != string(plain.Bytes()) {
+		t.Errorf("-explain changed the output:\n%s\nexpected:\n%s", explained.Bytes(), plain.Bytes())
+	}
+
+	expected := map[string]string{
+		"locals":                              "attribute/" + reasonFallback,
+		"resource":                            "block/" + reasonKnownBlock,
+		"resource.aws_instance.web.ami":       "attribute/" + reasonValueShape,
+		"resource.aws_instance.web.lifecycle": "block/" + reasonKnownBlock,
+		"subnets":                             "attribute/" + reasonStructure,
+	}
+	actual := make(map[string]string)
+	for _, entry := range explainer.entries {
+		if _, want := expected[entry.Path]; want {
+			actual[entry.Path] = entry.Decision + "/" + entry.Reason
+		}
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected decisions:\n%v\nexpected:\n%v", actual, expected)
+	}
+
+	var text bytes.Buffer
+	if err := explainer.write(&text, "text"); err != nil {
+		t.Fatalf("Failed to write explanation: %v", err)
+	}
+	if !strings.HasPrefix(text.String(), "locals ") {
+		t.Errorf("Expected the explanation to be ordered by path, got:\n%s", text.String())
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+	targetFileType = "terraform"
+
+	errorCases := map[string]string{
+		`{"kubernetes.io/cluster/prod": "owned"}`:                        `"kubernetes.io/cluster/prod" at the top level`,
+		`{"resource": {"aws_instance": {"web": {"123abc": 1}}}}`:         `"123abc" in resource "aws_instance" "web"`,
+		`{"__blocks": [{"type": "my block", "labels": [], "body": {}}]}`: `"my block" in __blocks`,
+	}
+	for input, message := range errorCases {
+		_, err := jsonToNativeFile([]byte(input), "names.json")
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected an error about %s for %s, got: %v", message, input, err)
+		}
+	}
+
+	// Keys that can't be names stay quoted keys of a map where blocks were only guessed,
+	// object keys are quoted only when needed and labels are escaped
+	input := `{"settings": [{"a": [{"my key": 1}]}], "tags": {"for": "x", "kubernetes.io/role": "y", "name": "z"}, ` +
+		`"resource": {"aws_instance": {"we b\"${x}": {"ami": "a"}}}}`
+	nativeFile, err := jsonToNativeFile([]byte(input), "names.json")
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	expected := `resource "aws_instance" "we b\"$${x}" {
+  ami = "a"
+}
+settings = [{
+  a = [{
+    "my key" = 1
+  }]
+}]
+tags = {
+  "for"                = "x"
+  "kubernetes.io/role" = "y"
+  name                 = "z"
+}
+`
+	if actual := string(nativeFile.Bytes()); actual != expected {
+		t.Errorf("Unexpected HCL:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	file, diags := hclparse.NewParser().ParseHCL(nativeFile.Bytes(), "names.tf")
+	if diags.HasErrors() {
+		t.Fatalf("Generated HCL doesn't parse: %s", diags.Error())
+	}
+	content, _, _ := file.Body.PartialContent(&hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{{Type: "resource", LabelNames: []string{"type", "name"}}}})
+	if label := content.Blocks[0].Labels[1]; label != `we b"${x}` {
+		t.Errorf("Label did not survive escaping: %q", label)
+	}
+}
+
+func TestNumericFidelity(t *testing.T) {
+	targetFileType = "terraform"
+
+	numbers := []string{
+		"0", "-1", "1.0", "0.1", "0.10", "1e3", "1E+3", "1.5e-7", "-2.50",
+		"9223372036854775807", "-9223372036854775808", "9223372036854775808", "18446744073709551616",
+		"123456789012345678901234567890", "3.141592653589793238462643383279",
+	}
+	for _, number := range numbers {
+		input := fmt.Sprintf(`{"v": %s, "list": [%s], "obj": {"k": %s}}`, number, number, number)
+		nativeFile, err := jsonToNativeFile([]byte(input), "numbers.json")
+		if err != nil {
+			t.Fatalf("Failed to convert %s: %v", number, err)
+		}
+		hclText := string(nativeFile.Bytes())
+		for _, expected := range []string{"v = " + number + "\n", "list = [" + number + "]", "k = " + number + "\n"} {
+			if !strings.Contains(hclText, expected) {
+				t.Errorf("Expected %q in HCL for %s, got:\n%s", expected, number, hclText)
+			}
+		}
+
+		jsonBytes, err := convert.Bytes(nativeFile.Bytes(), "numbers.tf", convert.Options{})
+		if err != nil {
+			t.Fatalf("Failed to convert %s back: %v", number, err)
+		}
+		expected := fmt.Sprintf(`{"list":[%s],"obj":{"k":%s},"v":%s}`, number, number, number)
+		if actual := string(jsonBytes); actual != expected {
+			t.Errorf("Unexpected JSON for %s: %s, expected %s", number, actual, expected)
+		}
+	}
+}
+
+func TestLineLayout(t *testing.T) {
+	targetFileType = "tfvars"
+
+	input := `{"short": [1, 2, 3], "long": ["alpha", "bravo", "charlie", "delta"], "tags": {"Name": "web", "Environment": "production"}, ` +
+		`"rules": [{"port": 80, "cidr": "0.0.0.0/0"}, {"port": 443, "cidr": "10.0.0.0/8", "description": "internal https"}], "empty": []}`
+	expected := `empty = []
+long = [
+  "alpha",
+  "bravo",
+  "charlie",
+  "delta",
+]
+rules = [
+  { cidr = "0.0.0.0/0", port = 80 },
+  {
+    cidr        = "10.0.0.0/8"
+    description = "internal https"
+    port        = 443
+  },
+]
+short = [1, 2, 3]
+tags = {
+  Environment = "production"
+  Name        = "web"
+}
+`
+	nativeFile, err := jsonToNativeFile([]byte(input), "layout.json")
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	layoutFile(nativeFile, lineLayout{maxWidth: 40, trailingCommas: true})
+	actual := string(nativeFile.Bytes())
+	if actual != expected {
+		t.Errorf("Unexpected HCL:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	// terraform fmt, which formats with hclwrite, must leave the output as it is
+	if formatted := string(hclwrite.Format([]byte(actual))); formatted != actual {
+		t.Errorf("Output changes when formatted:\n%s", formatted)
+	}
+	for _, line := range strings.Split(actual, "\n") {
+		if len(line) > 40 {
+			t.Errorf("Line exceeds the width: %q", line)
+		}
+	}
+
+	// Without a width the default layout is kept
+	nativeFile, err = jsonToNativeFile([]byte(input), "layout.json")
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	unchanged := string(nativeFile.Bytes())
+	layoutFile(nativeFile, lineLayout{})
+	if actual := string(nativeFile.Bytes()); actual != unchanged {
+		t.Errorf("Layout without a width changed the output:\n%s", actual)
+	}
+}
+
+func TestFormatHCL(t *testing.T) {
+	input := `# Managed by hand
+resource "aws_instance" "web" {
+  tags = { Name = "web" }
+  ami = "${var.ami}"
+  name = "web-${var.env}"
+
+  provisioner "local-exec" {
+    command = "echo b"
+  }
+  count = 2
+  provisioner "local-exec" {
+    command = "echo a"
+  }
+}
+locals {
+  b = 1
+  # a comment of its own keeps the order
+
+  a = [1, 2]
+}
+`
+	expected := `# Managed by hand
+locals {
+  b = 1
+  # a comment of its own keeps the order
+
+  a = [1, 2]
+}
+resource "aws_instance" "web" {
+  ami   = var.ami
+  count = 2
+  name  = "web-${var.env}"
+
+  provisioner "local-exec" {
+    command = "echo b"
+  }
+  provisioner "local-exec" {
+    command = "echo a"
+  }
+  tags = { Name = "web" }
+}
+`
+	options := fmtOptions{sort: true, unwrap: true, layout: lineLayout{maxWidth: 80}}
+	formatted, err := formatHCL([]byte(input), "main.tf", options)
+	if err != nil {
+		t.Fatalf("Failed to format: %v", err)
+	}
+	if string(formatted) != expected {
+		t.Errorf("Unexpected formatting:\n%s\nexpected:\n%s", formatted, expected)
+	}
+
+	again, err := formatHCL(formatted, "main.tf", options)
+	if err != nil || string(again) != string(formatted) {
+		t.Errorf("Formatting is not stable: %v\n%s", err, again)
+	}
+
+	// Blank lines stay between the items when they are reordered
+	spaced := `variable "b" {
+  default = 2
+}
+
+# The first variable
+variable "a" {
+  default = 1 # one
+}
+
+
+output "x" {
+  value = 1
+}
+`
+	expectedSpaced := `output "x" {
+  value = 1
+}
+
+variable "b" {
+  default = 2
+}
+
+
+# The first variable
+variable "a" {
+  default = 1 # one
+}
+`
+	formatted, err = formatHCL([]byte(spaced), "main.tf", options)
+	if err != nil {
+		t.Fatalf("Failed to format: %v", err)
+	}
+	if string(formatted) != expectedSpaced {
+		t.Errorf("Unexpected formatting:\n%s\nexpected:\n%s", formatted, expectedSpaced)
+	}
+
+	// A file header of its own stays at the top as well
+	header := "# Generated settings\n\nvariable \"a\" {}\noutput \"b\" {}\n"
+	expectedHeader := "# Generated settings\n\noutput \"b\" {}\nvariable \"a\" {}\n"
+	formatted, err = formatHCL([]byte(header), "main.tf", options)
+	if err != nil {
+		t.Fatalf("Failed to format: %v", err)
+	}
+	if string(formatted) != expectedHeader {
+		t.Errorf("Unexpected formatting:\n%s\nexpected:\n%s", formatted, expectedHeader)
+	}
+
+	diff := unifiedDiff("main.tf", []byte("a = 1\nb = 2\n"), []byte("a = 1\nb = 3\n"))
+	expectedDiff := "--- main.tf\n+++ main.tf\n@@ -1,2 +1,2 @@\n a = 1\n-b = 2\n+b = 3\n"
+	if diff != expectedDiff {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+}
+
+func TestUpgradeHCL(t *testing.T) {
+	input := `variable "names" {
+  type = "list"
+}
+variable "tags" {
+  type = "map"
+}
+resource "aws_instance" "web" {
+  provider = "aws.west"
+  ami = "${var.ami}"
+  name = "web-${var.env}"
+  tags = "${merge(var.tags, map("Name", "${var.name}"))}"
+  type = "string"
+  depends_on = ["aws_security_group.web"]
+  lifecycle {
+    ignore_changes = ["*"]
+  }
+}
+locals {
+  sum = "${var.a + var.b}" * 2
+  pick = "${var.c ? 1 : 2}" == 1
+  whole = "${var.a + var.b}"
+}
+`
+	expected := `variable "names" {
+  type = list(any)
+}
+variable "tags" {
+  type = map(any)
+}
+resource "aws_instance" "web" {
+  provider   = aws.west
+  ami        = var.ami
+  name       = "web-${var.env}"
+  tags       = merge(var.tags, map("Name", var.name))
+  type       = "string"
+  depends_on = [aws_security_group.web]
+  lifecycle {
+    ignore_changes = all
+  }
+}
+locals {
+  sum   = (var.a + var.b) * 2
+  pick  = (var.c ? 1 : 2) == 1
+  whole = var.a + var.b
+}
+`
+	upgraded, changes, err := upgradeHCL([]byte(input), "main.tf")
+	if err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+	if string(upgraded) != expected {
+		t.Errorf("Unexpected upgrade:\n%s\nexpected:\n%s", upgraded, expected)
+	}
+
+	expectedChanges := []string{
+		`variable.names.type: quoted type constraint: "list" -> list(any)`,
+		`variable.tags.type: quoted type constraint: "map" -> map(any)`,
+		`resource.aws_instance.web.ami: interpolation-only template: "${var.ami}" -> var.ami`,
+		`resource.aws_instance.web.depends_on: quoted reference: "aws_security_group.web" -> aws_security_group.web`,
+		`resource.aws_instance.web.provider: quoted reference: "aws.west" -> aws.west`,
+		`resource.aws_instance.web.tags: interpolation-only template: "${var.name}" -> var.name`,
+		`resource.aws_instance.web.tags: interpolation-only template: "${merge(var.tags, map("Name", "${var.name}"))}" -> merge(var.tags, map("Name", var.name))`,
+		`resource.aws_instance.web.lifecycle.ignore_changes: quoted reference: ["*"] -> all`,
+		`locals.pick: interpolation-only template: "${var.c ? 1 : 2}" -> (var.c ? 1 : 2)`,
+		`locals.sum: interpolation-only template: "${var.a + var.b}" -> (var.a + var.b)`,
+		`locals.whole: interpolation-only template: "${var.a + var.b}" -> var.a + var.b`,
+	}
+	var actualChanges []string
+	for _, change := range changes {
+		actualChanges = append(actualChanges, change.String())
+	}
+	if strings.Join(actualChanges, "\n") != strings.Join(expectedChanges, "\n") {
+		t.Errorf("Unexpected changes:\n%s\nexpected:\n%s", strings.Join(actualChanges, "\n"), strings.Join(expectedChanges, "\n"))
+	}
+
+	// Upgraded files have nothing left to upgrade
+	if _, changes, _ := upgradeHCL(upgraded, "main.tf"); len(changes) != 0 {
+		t.Errorf("Expected no changes for upgraded HCL, got %v", changes)
+	}
+}
+
+func TestMetaArgumentReferences(t *testing.T) {
+	targetFileType = "terraform"
+
+	input := `{
+  "module": {"vpc": {"source": "./vpc", "providers": {"aws": "aws.west", "aws.peer": "aws.east"}}},
+  "resource": {"aws_instance": {"web": {
+    "provider": "aws.west",
+    "depends_on": ["aws_s3_bucket.logs", "module.vpc"],
+    "tags": {"Name": "aws.west"},
+    "lifecycle": {"ignore_changes": ["ami", "tags[\"Name\"]"]}
+  }}}
+}`
+	expected := `module "vpc" {
+  providers = {
+    aws      = aws.west
+    aws.peer = aws.east
+  }
+  source = "./vpc"
+}
+resource "aws_instance" "web" {
+  depends_on = [aws_s3_bucket.logs, module.vpc]
+  lifecycle {
+    ignore_changes = [ami, tags["Name"]]
+  }
+  provider = aws.west
+  tags = {
+    Name = "aws.west"
+  }
+}
+`
+	nativeFile, err := jsonToNativeFile([]byte(input), "main.tf.json")
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	if actual := string(nativeFile.Bytes()); actual != expected {
+		t.Errorf("Unexpected HCL:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	// Terraform JSON writes the references as plain strings again
+	jsonBytes, err := convert.Bytes(nativeFile.Bytes(), "main.tf", convert.Options{})
+	if err != nil {
+		t.Fatalf("Failed to convert back: %v", err)
+	}
+	for _, fragment := range []string{
+		`"providers":{"aws":"aws.west","aws.peer":"aws.east"}`,
+		`"depends_on":["aws_s3_bucket.logs","module.vpc"]`,
+		`"ignore_changes":["ami","tags[\"Name\"]"]`,
+		`"provider":"aws.west"`,
+	} {
+		if !strings.Contains(string(jsonBytes), fragment) {
+			t.Errorf("Expected %s in JSON, got: %s", fragment, jsonBytes)
+		}
+	}
+}
+
+func TestTerraformNestedBlockSchema(t *testing.T) {
+	targetFileType = "terraform"
+
+	input := `{
+  "locals": {"lifecycle": [{"a": 1}]},
+  "variable": {"rules": {"default": [{"port": 80}]}},
+  "resource": {"aws_instance": {"web": {
+    "lifecycle": [{"prevent_destroy": true}],
+    "dynamic": {"a": {"for_each": "${var.a}", "content": {"dynamic": {"b": {"for_each": "${var.b}", "content": {"k": 1}}}}}}
+  }}}
+}`
+	nativeFile, err := jsonToNativeFile([]byte(input), "main.tf.json")
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	actual := string(nativeFile.Bytes())
+
+	for _, expected := range []string{
+		"lifecycle = [{",
+		"default = [{",
+		"  lifecycle {\n    prevent_destroy = true\n  }",
+		"      dynamic \"b\" {",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, actual)
+		}
+	}
+}
+
+func TestTypeConstraintsOnlyInVariables(t *testing.T) {
+	targetFileType = "terraform"
+
+	input := `{"resource": {"x": {"y": {"type": "string"}}}, "variable": {"v": {"type": "list(string)"}}}`
+	nativeFile, err := jsonToNativeFile([]byte(input), "main.tf.json")
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	actual := string(nativeFile.Bytes())
+	for _, expected := range []string{`type = "string"`, `type = list(string)`} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, actual)
+		}
+	}
+
+	jsonBytes, err := convert.Bytes([]byte("resource \"x\" \"y\" {\n  type = list(string)\n}\nvariable \"v\" {\n  type = list(string)\n}\n"), "main.tf", convert.Options{})
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	expected := `{"resource":{"x":{"y":[{"type":"${list(string)}"}]}},"variable":{"v":[{"type":"list(string)"}]}}`
+	if string(jsonBytes) != expected {
+		t.Errorf("Unexpected JSON:\n%s\nexpected:\n%s", jsonBytes, expected)
+	}
+}
+
+func TestTerraformBlocksOnlyForTerraform(t *testing.T) {
+	input := `group "web" {
+  task "app" {
+    lifecycle {
+      hook = "prestart"
+    }
+    dynamic "env" {
+      for_each = []
+    }
+  }
+}
+`
+	jsonBytes, err := convert.Bytes([]byte(input), "job.hcl", convert.Options{})
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	expected := `{"group":{"web":[{"task":{"app":[{"lifecycle":[{"hook":"prestart"}],"dynamic":{"env":[{"for_each":[]}]}}]}}]}}`
+	if string(jsonBytes) != expected {
+		t.Errorf("Unexpected JSON for non-Terraform input:\n%s\nexpected:\n%s", jsonBytes, expected)
+	}
+
+	jsonBytes, err = convert.Bytes([]byte(input), "job.hcl", convert.Options{Terraform: true})
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	expected = `{"group":{"web":[{"task":{"app":[{"lifecycle":[{"hook":"prestart"}],"dynamic":{"env":{"for_each":[]}}}]}}]}}`
+	if string(jsonBytes) != expected {
+		t.Errorf("Unexpected JSON for Terraform input:\n%s\nexpected:\n%s", jsonBytes, expected)
+	}
+}
+
+func TestTemplateStringEscaping(t *testing.T) {
+	targetFileType = "terraform"
+
+	input := `{"locals": {"greeting": "say \"hi\" to ${var.name}\nbye", "path": "C:\\${lookup(var.dirs, \"app\")}\t$${literal}"}}`
+	nativeFile, err := jsonToNativeFile([]byte(input), "main.tf.json")
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	actual := string(nativeFile.Bytes())
+	expected := "locals {\n" +
+		"  greeting = \"say \\\"hi\\\" to ${var.name}\\nbye\"\n" +
+		"  path     = \"C:\\\\${lookup(var.dirs, \"app\")}\\t$${literal}\"\n" +
+		"}\n"
+	if actual != expected {
+		t.Errorf("Unexpected HCL:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	jsonBytes, err := convert.Bytes(nativeFile.Bytes(), "main.tf", convert.Options{})
+	if err != nil {
+		t.Fatalf("Generated HCL is not valid: %v", err)
+	}
+	expected = `{"locals":[{"greeting":"say \"hi\" to ${var.name}\nbye","path":"C:\\${lookup(var.dirs, \"app\")}\t$${literal}"}]}`
+	if string(jsonBytes) != expected {
+		t.Errorf("Templates did not round trip:\n%s\nexpected:\n%s", jsonBytes, expected)
+	}
+}
+
+func TestSplitFilename(t *testing.T) {
+	rules, err := parseSplitMap("resource=resources.tf, resource.aws_iam_=iam.tf, module=modules.tf")
+	if err != nil {
+		t.Fatalf("Failed to parse split map: %v", err)
+	}
+
+	tests := []struct {
+		blockType string
+		labels    []string
+		expected  string
+	}{
+		{"terraform", nil, "versions.tf"},
+		{"variable", []string{"region"}, "variables.tf"},
+		{"resource", []string{"aws_iam_role", "x"}, "iam.tf"},
+		{"resource", []string{"aws_instance", "x"}, "resources.tf"},
+		{"module", []string{"vpc"}, "modules.tf"},
+		{"moved", nil, "main.tf"},
+	}
+	for _, test := range tests {
+		if actual := splitFilename(test.blockType, test.labels, rules); actual != test.expected {
+			t.Errorf("splitFilename(%s, %v) = %s, expected %s", test.blockType, test.labels, actual, test.expected)
+		}
+	}
+
+	if _, err := parseSplitMap("resource"); err == nil {
+		t.Errorf("Expected an error for a mapping without a file")
+	}
+}
+
+func TestMergeIntoFile(t *testing.T) {
+	existing := `# Hand-written provider
+provider "aws" {
+  region  = "eu-west-1" # pinned by ops
+  profile = "prod"
+}
+
+locals {
+  untouched = true
+}
+
+resource "aws_instance" "web" {
+  ami = "ami-old"
+  tags = {
+    Name = "web"
+  }
+}
+`
+	input := `{
+  "provider": {"aws": [{"region": "us-east-1"}]},
+  "resource": {"aws_instance": {"web": [{"ami": "ami-new"}], "db": [{"ami": "ami-db"}]}}
+}`
+
+	targetFileType = "terraform"
+	path := filepath.Join(t.TempDir(), "main.tf")
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatalf("Failed to write merge target: %v", err)
+	}
+
+	generated, err := jsonToNativeFile([]byte(input), "<test>")
+	if err != nil {
+		t.Fatalf("Failed to convert input: %v", err)
+	}
+	if err := mergeIntoFile(path, generated); err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+
+	merged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read merged file: %v", err)
+	}
+
+	for _, expected := range []string{
+		"# Hand-written provider",
+		`region  = "us-east-1" # pinned by ops`,
+		`profile = "prod"`,
+		"untouched = true",
+		`ami = "ami-new"`,
+		`Name = "web"`,
+		`resource "aws_instance" "db" {`,
+	} {
+		if !strings.Contains(string(merged), expected) {
+			t.Errorf("Expected merged file to contain %q, got:\n%s", expected, merged)
+		}
+	}
+	if strings.Contains(string(merged), "ami-old") {
+		t.Errorf("Expected ami-old to be replaced, got:\n%s", merged)
+	}
+	if strings.Count(string(merged), `resource "aws_instance" "web"`) != 1 {
+		t.Errorf("Expected matching block to be updated in place, got:\n%s", merged)
+	}
+
+	// New attributes keep their order, replaced blocks stay where they were
+	existing = `provider "aws" {
+  region = "eu-west-1"
+}
+
+resource "aws_security_group" "web" {
+  a = 1
+  ingress {
+    from_port = 22
+  }
+  name = "web"
+}
+
+output "id" {
+  value = 1
+}
+`
+	input = `{
+  "provider": {"aws": [{"region": "eu-west-1"}, {"alias": "us", "region": "us-east-1"}]},
+  "resource": {"aws_security_group": {"web": [{
+    "a": 1, "e": 5, "d": 4, "c": 3, "b": 2,
+    "ingress": [{"from_port": 80}, {"from_port": 443}],
+    "name": "web"
+  }]}}
+}`
+	expected := `provider "aws" {
+  region = "eu-west-1"
+}
+
+provider "aws" {
+  alias  = "us"
+  region = "us-east-1"
+}
+
+resource "aws_security_group" "web" {
+  a = 1
+  ingress {
+    from_port = 80
+  }
+  ingress {
+    from_port = 443
+  }
+  name = "web"
+  b    = 2
+  c    = 3
+  d    = 4
+  e    = 5
+}
+
+output "id" {
+  value = 1
+}
+`
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatalf("Failed to write merge target: %v", err)
+	}
+	declaredBlockTypes = map[string]int{"ingress": 0}
+	defer func() { declaredBlockTypes = map[string]int{} }()
+	generated, err = jsonToNativeFile([]byte(input), "<test>")
+	if err != nil {
+		t.Fatalf("Failed to convert input: %v", err)
+	}
+	if err := mergeIntoFile(path, generated); err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	if merged, _ = os.ReadFile(path); string(merged) != expected {
+		t.Errorf("Unexpected merge:\n%s\nexpected:\n%s", merged, expected)
+	}
+
+	// Comments above replaced blocks stay above their replacements
+	existing = `resource "aws_security_group" "web" {
+  # first
+  ingress {
+    from_port = 22
+  }
+  # between
+  ingress {
+    from_port = 23
+  }
+}
+`
+	input = `{"resource": {"aws_security_group": {"web": [{"ingress": [{"from_port": 80}, {"from_port": 443}, {"from_port": 8080}]}]}}}`
+	expected = `resource "aws_security_group" "web" {
+  # first
+  ingress {
+    from_port = 80
+  }
+  # between
+  ingress {
+    from_port = 443
+  }
+  ingress {
+    from_port = 8080
+  }
+}
+`
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatalf("Failed to write merge target: %v", err)
+	}
+	generated, err = jsonToNativeFile([]byte(input), "<test>")
+	if err != nil {
+		t.Fatalf("Failed to convert input: %v", err)
+	}
+	if err := mergeIntoFile(path, generated); err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	if merged, _ = os.ReadFile(path); string(merged) != expected {
+		t.Errorf("Unexpected merge:\n%s\nexpected:\n%s", merged, expected)
+	}
+}
+
+func TestPatchHCL(t *testing.T) {
+	src := `# Managed by hand
+terraform {
+  required_version   =   ">= 1.0"   # odd spacing is kept
+}
+
+resource "aws_instance" "web" {
+  ami           = "ami-1" # the AMI
+  instance_type = "t3.micro"
+  tags = {
+    Name = "web"
+  }
+}
+`
+	tests := []struct {
+		name     string
+		patch    string
+		expected []string
+		absent   []string
+	}{
+		{
+			name: "JSON Patch",
+			patch: `[
+				{"op": "test", "path": "/resource/aws_instance/web/0/ami", "value": "ami-1"},
+				{"op": "replace", "path": "/resource/aws_instance/web/0/ami", "value": "ami-2"},
+				{"op": "add", "path": "/resource/aws_instance/web/0/tags/Env", "value": "prod"},
+				{"op": "remove", "path": "/resource/aws_instance/web/0/instance_type"},
+				{"op": "add", "path": "/resource/aws_instance/db", "value": [{"ami": "ami-db"}]}
+			]`,
+			expected: []string{
+				`ami           = "ami-2" # the AMI`,
+				`Env  = "prod"`,
+				`resource "aws_instance" "db" {`,
+			},
+			absent: []string{"instance_type"},
+		},
+		{
+			name:  "JSON Merge Patch",
+			patch: `{"resource": {"aws_instance": {"web": {"ami": "ami-3", "instance_type": null}}}}`,
+			expected: []string{
+				`ami           = "ami-3" # the AMI`,
+			},
+			absent: []string{"instance_type"},
+		},
+		{
+			name: "Meta-arguments",
+			patch: `[
+				{"op": "add", "path": "/resource/aws_instance/web/0/depends_on", "value": ["aws_s3_bucket.a", "aws_s3_bucket.b"]},
+				{"op": "add", "path": "/resource/aws_instance/web/0/provider", "value": "aws.east"},
+				{"op": "add", "path": "/resource/aws_instance/db", "value": [{"ami": "ami-db", "provider": "aws.west"}]}
+			]`,
+			expected: []string{
+				`depends_on = [aws_s3_bucket.a, aws_s3_bucket.b]`,
+				`provider = aws.east`,
+				`provider = aws.west`,
+			},
+			absent: []string{`"aws.east"`, `"aws.west"`, `"aws_s3_bucket.a"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patch, err := decodeJSON([]byte(test.patch))
+			if err != nil {
+				t.Fatalf("Failed to decode patch: %v", err)
+			}
+
+			targetFileType = "terraform"
+			patched, err := patchHCL([]byte(src), "main.tf", patch)
+			if err != nil {
+				t.Fatalf("Failed to patch: %v", err)
+			}
+
+			// Everything up to the patched resource must be byte-identical
+			head := src[:strings.Index(src, "resource")]
+			if !strings.HasPrefix(string(patched), head) {
+				t.Errorf("Expected untouched content to be kept byte for byte, got:\n%s", patched)
+			}
+			for _, expected := range test.expected {
+				if !strings.Contains(string(patched), expected) {
+					t.Errorf("Expected patched file to contain %q, got:\n%s", expected, patched)
+				}
+			}
+			for _, absent := range test.absent {
+				if strings.Contains(string(patched), absent) {
+					t.Errorf("Expected patched file not to contain %q, got:\n%s", absent, patched)
+				}
+			}
+		})
+	}
+
+	// Integers past float64 precision still count as changed
+	src = "variable \"acct\" {\n  default = 123456789012345678\n}\n"
+	patch, _ := decodeJSON([]byte(`[{"op": "replace", "path": "/variable/acct/0/default", "value": 123456789012345679}]`))
+	patched, err := patchHCL([]byte(src), "main.tf", patch)
+	if err != nil {
+		t.Fatalf("Failed to patch: %v", err)
+	}
+	if !strings.Contains(string(patched), "default = 123456789012345679") {
+		t.Errorf("Expected the large integer to be replaced, got:\n%s", patched)
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	doc, _ := decodeJSON([]byte(`{"a": [1, 2], "b": {"c": "d"}, "n": 123456789012345678}`))
+
+	tests := []string{
+		`[{"op": "test", "path": "/b/c", "value": "x"}]`,
+		`[{"op": "test", "path": "/n", "value": 123456789012345679}]`,
+		`[{"op": "remove", "path": "/missing"}]`,
+		`[{"op": "add", "path": "/a/5", "value": 3}]`,
+		`[{"op": "move", "from": "/b", "path": "/b/c/e"}]`,
+		`[{"op": "frobnicate", "path": "/a"}]`,
+	}
+	for _, test := range tests {
+		patch, _ := decodeJSON([]byte(test))
+		if _, err := applyJSONPatch(deepCopyJSON(doc), patch.([]interface{})); err == nil {
+			t.Errorf("Expected patch %s to fail", test)
+		}
+	}
+
+	patch, _ := decodeJSON([]byte(`[{"op": "move", "from": "/b/c", "path": "/a/-"}, {"op": "copy", "from": "/a/0", "path": "/e"}]`))
+	patched, err := applyJSONPatch(deepCopyJSON(doc), patch.([]interface{}))
+	if err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	expected, _ := decodeJSON([]byte(`{"a": [1, 2, "d"], "b": {}, "e": 1, "n": 123456789012345678}`))
+	if !jsonEqual(patched, expected) {
+		t.Errorf("Unexpected patch result: %v", patched)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	src := []byte(`variable "region" {
+  default = "eu-west-1"
+}
+
+resource "aws_instance" "web" {
+  ami        = "ami-1"
+  tags       = { Name = "web", "kubernetes.io/role" = var.role }
+  depends_on = [aws_s3_bucket.logs]
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
+resource "aws_instance" "db" {
+  ami = upper("ami-2")
+}
+`)
+	root, err := parseQueryTree(src, "main.tf")
+	if err != nil {
+		t.Fatalf("Failed to parse query tree: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		format   string
+		expected []string
+	}{
+		{"resource.aws_instance.*.ami", "json", []string{`"ami-1"`, `"${upper(\"ami-2\")}"`}},
+		{"resource.aws_instance.*.ami", "hcl", []string{`"ami-1"`, `upper("ami-2")`}},
+		{"variable.region[0].default", "location", []string{"main.tf:2,13-24"}},
+		{"variable.region.default", "json", []string{`"eu-west-1"`}},
+		{`resource.aws_instance.web.tags["kubernetes.io/role"]`, "hcl", []string{"var.role"}},
+		{"resource.aws_instance.web[1]", "json", nil},
+		{"resource.aws_instance.web.depends_on", "json", []string{"[\n  \"aws_s3_bucket.logs\"\n]"}},
+		{"resource.aws_instance.web.depends_on[0]", "hcl", []string{"aws_s3_bucket.logs"}},
+		{"resource.aws_instance.web.lifecycle", "json", []string{"{\n  \"create_before_destroy\": true\n}"}},
+		{"resource.aws_instance.web.lifecycle.create_before_destroy", "location", []string{"main.tf:10,29-33"}},
+	}
+	for _, test := range tests {
+		path, err := parseQueryPath(test.path)
+		if err != nil {
+			t.Fatalf("Failed to parse path %s: %v", test.path, err)
+		}
+
+		var actual []string
+		for _, match := range root.query(path) {
+			output, err := match.render(test.format, src)
+			if err != nil {
+				t.Fatalf("Failed to render %s: %v", test.path, err)
+			}
+			actual = append(actual, output)
+		}
+		if strings.Join(actual, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("query %s (%s) = %q, expected %q", test.path, test.format, actual, test.expected)
+		}
+	}
+
+	if _, err := parseQueryPath("resource[0"); err == nil {
+		t.Errorf("Expected an error for an unclosed index")
+	}
+
+	filename := filepath.Join(t.TempDir(), "main.tf")
+	if err := os.WriteFile(filename, src, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := runQuery([]string{"-format", "bogus", "no.such.path", filename}); err == nil {
+		t.Errorf("Expected an error for an unknown format without matches")
+	}
+}
+
+func TestInferType(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected string
+	}{
+		{`"eu-west-1"`, "string"},
+		{`42`, "number"},
+		{`["a", "b"]`, "list(string)"},
+		{`[]`, "list(any)"},
+		{`{"Name": "web", "Env": "prod"}`, "map(string)"},
+		{`{"a": {"x": 1}, "b": {"x": 2}}`, "map(map(number))"},
+		{`{"cidr": "10.0.0.0/16", "dns": true}`, "object({\ncidr = string\ndns = bool\n})"},
+		{`[{"name": "a", "port": 80}, {"name": "b"}]`, "list(object({\nname = string\nport = optional(number)\n}))"},
+		{`[1, "a"]`, "list(any)"},
+		{`[null, 1]`, "list(number)"},
+		{`{"my key": 1, "cidr": "10.0.0.0/16"}`, "map(any)"},
+		{`{"team/a": {"port": 80}, "team/b": {"name": "b"}}`, "map(object({\nname = optional(string)\nport = optional(number)\n}))"},
+	}
+	for _, test := range tests {
+		value, err := decodeJSON([]byte(test.json))
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", test.json, err)
+		}
+		actual := inferType(value).String()
+		if actual != test.expected {
+			t.Errorf("inferType(%s) = %q, expected %q", test.json, actual, test.expected)
+		}
+		expr, diags := hclsyntax.ParseExpression([]byte(actual), "type", hcl.Pos{Line: 1, Column: 1})
+		if !diags.HasErrors() {
+			_, _, diags = typeexpr.TypeConstraintWithDefaults(expr)
+		}
+		if diags.HasErrors() {
+			t.Errorf("inferType(%s) is not a valid type constraint: %s", test.json, diags.Error())
+		}
+	}
+}
+
+func TestVariableDeclarations(t *testing.T) {
+	input, err := os.ReadFile("fixtures/complex.tfvars.json")
+	if err != nil {
+		t.Fatalf("Failed to read input file: %v", err)
+	}
+
+	file, err := variableDeclarations(input, true, map[string]string{"vpc": "VPC settings"})
+	if err != nil {
+		t.Fatalf("Failed to generate variables: %v", err)
+	}
+
+	output := string(hclwrite.Format(file.Bytes()))
+	if _, diags := hclparse.NewParser().ParseHCL([]byte(output), "variables.tf"); diags.HasErrors() {
+		t.Fatalf("Generated variables are not valid HCL: %v\n%s", diags.Error(), output)
+	}
+	for _, expected := range []string{
+		`variable "vpc" {`,
+		`description = "VPC settings"`,
+		"type = list(object({",
+		"default = {",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected generated variables to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestCheckTFVars(t *testing.T) {
+	dir := t.TempDir()
+	module := `variable "region" {
+  type = string
+  validation {
+    condition     = can(regex("^[a-z]+-[a-z]+-[0-9]$", var.region))
+    error_message = "Region must look like eu-west-1."
+  }
+}
+
+variable "instance_count" {
+  type    = number
+  default = 1
+}
+
+variable "services" {
+  type = list(object({ name = string, port = optional(number, 80) }))
+}
+
+variable "cfg" {
+  type    = object({ a = optional(string), b = optional(list(object({ c = number }))) })
+  default = null
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "variables.tf"), []byte(module), 0644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+
+	variables, err := loadModuleVariables([]string{dir})
+	if err != nil {
+		t.Fatalf("Failed to load variables: %v", err)
+	}
+
+	output, problems, err := checkTFVars([]byte(`{"region": "eu-west-1", "instance_count": "42", "services": [{"name": "web"}, {"name": "api", "port": 8080.0}]}`), variables)
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("Expected valid tfvars, got %v %v", err, problems)
+	}
+	if string(output) != `{"instance_count":42,"region":"eu-west-1","services":[{"name":"web"},{"name":"api","port":8080.0}]}` {
+		t.Errorf("Unexpected converted tfvars: %s", output)
+	}
+
+	_, problems, err = checkTFVars([]byte(`{"region": "EU", "services": [{"name": "web", "port": "http"}], "extra": true}`), variables)
+	if err != nil {
+		t.Fatalf("Failed to check tfvars: %v", err)
+	}
+	expected := []string{
+		"var.extra: variable is not declared",
+		"var.services[0].port: a number is required",
+		"var.region: Region must look like eu-west-1.",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected problems:\n%s\nexpected:\n%s", strings.Join(problems, "\n"), strings.Join(expected, "\n"))
+	}
+
+	_, problems, _ = checkTFVars([]byte(`{"region": "eu-west-1"}`), variables)
+	if len(problems) != 1 || problems[0] != "var.services: required variable is not set" {
+		t.Errorf("Expected missing required variable to be reported, got %v", problems)
+	}
+
+	// Values whose types can't be converted at all still name the attribute at fault
+	for input, expected := range map[string]string{
+		`{"a": {"x": 1}}`:             "var.cfg.a: string required",
+		`{"b": [{"c": {"y": true}}]}`: "var.cfg.b[0].c: number required",
+	} {
+		_, problems, _ = checkTFVars([]byte(`{"region": "eu-west-1", "services": [], "cfg": `+input+`}`), variables)
+		if len(problems) != 1 || problems[0] != expected {
+			t.Errorf("Expected %q for %s, got %v", expected, input, problems)
+		}
+	}
+}
+
+func TestTFVarsTemplate(t *testing.T) {
+	dir := t.TempDir()
+	module := `variable "region" {
+  description = "AWS region to deploy into"
+  type        = string
+  default     = "eu-west-1"
+}
+
+variable "subnets" {
+  type = list(object({ cidr = string, public = optional(bool) }))
+}
+
+variable "settings" {
+  type = object({ name = string, size = number, enabled = bool, public = optional(bool) })
+}
+
+variable "name_ref" {
+  default = "$${name}"
+}
+
+variable "greeting" {
+  default = "Hi $${name}"
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "variables.tf"), []byte(module), 0644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+
+	variables, err := loadModuleVariables([]string{dir})
+	if err != nil {
+		t.Fatalf("Failed to load variables: %v", err)
+	}
+
+	expected := `# AWS region to deploy into
+region = "eu-west-1"
+
+subnets = []
+
+settings = {
+  enabled = false
+  name    = ""
+  size    = 0
+}
+
+name_ref = "$${name}"
+
+greeting = "Hi $${name}"
+`
+	if actual := string(hclwrite.Format(tfvarsTemplate(variables).Bytes())); actual != expected {
+		t.Errorf("Unexpected tfvars template:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	out, err := tfvarsTemplateJSON(variables)
+	if err != nil {
+		t.Fatalf("Failed to render JSON template: %v", err)
+	}
+	var actualJSON map[string]interface{}
+	if err := json.Unmarshal(out, &actualJSON); err != nil {
+		t.Fatalf("Template is not valid JSON: %v", err)
+	}
+	if actualJSON["region"] != "eu-west-1" || actualJSON["greeting"] != "Hi ${name}" || len(actualJSON) != 5 {
+		t.Errorf("Unexpected JSON template: %s", out)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	dir := t.TempDir()
+	module := `variable "region" {
+  description = "AWS region to deploy into"
+  type        = string
+  nullable    = false
+  validation {
+    condition     = can(regex("^[a-z]+-[a-z]+-[0-9]$", var.region))
+    error_message = "Region must look like eu-west-1."
+  }
+}
+
+variable "env" {
+  type    = string
+  default = "dev"
+  validation {
+    condition     = contains(["dev", "prod"], var.env) && length(var.env) < 5
+    error_message = "Unknown environment."
+  }
+}
+
+variable "instances" {
+  type     = number
+  nullable = false
+  validation {
+    condition     = var.instances >= 1 && 10 > var.instances
+    error_message = "Between 1 and 9 instances."
+  }
+}
+
+variable "services" {
+  type      = list(object({ name = string, port = optional(number, 80) }))
+  sensitive = true
+}
+
+variable "extra" {}
+`
+	if err := os.WriteFile(filepath.Join(dir, "variables.tf"), []byte(module), 0644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+
+	variables, err := loadModuleVariables([]string{dir})
+	if err != nil {
+		t.Fatalf("Failed to load variables: %v", err)
+	}
+
+	out, err := json.Marshal(variablesSchema(variables))
+	if err != nil {
+		t.Fatalf("Failed to render schema: %v", err)
+	}
+
+	expected := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["extra", "instances", "region", "services"],
+  "properties": {
+    "region": {
+      "type": "string",
+      "description": "AWS region to deploy into",
+      "pattern": "^[a-z]+-[a-z]+-[0-9]$"
+    },
+    "env": {
+      "type": ["string", "null"],
+      "default": "dev",
+      "enum": ["dev", "prod"],
+      "maxLength": 4
+    },
+    "instances": {"type": "number", "minimum": 1, "exclusiveMaximum": 10},
+    "services": {
+      "type": ["array", "null"],
+      "writeOnly": true,
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["name"],
+        "properties": {
+          "name": {"type": "string"},
+          "port": {"type": "number", "default": 80}
+        }
+      }
+    },
+    "extra": {}
+  }
+}`
+	var actualSchema, expectedSchema interface{}
+	if err := json.Unmarshal(out, &actualSchema); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(expected), &expectedSchema); err != nil {
+		t.Fatalf("Invalid expected schema: %v", err)
+	}
+	if !reflect.DeepEqual(actualSchema, expectedSchema) {
+		t.Errorf("Unexpected schema:\n%s", out)
+	}
+}
+
+func TestModuleDocs(t *testing.T) {
+	dir := t.TempDir()
+	module := `terraform {
+  required_version = ">= 1.3"
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 5.0"
+    }
+  }
+}
+
+provider "aws" {
+  alias  = "us"
+  region = "us-east-1"
+}
+
+module "vpc" {
+  source = "./vpc"
+}
+
+resource "random_id" "suffix" {
+  byte_length = 4
+}
+
+data "aws_ami" "ubuntu" {
+  most_recent = true
+}
+
+variable "tags" {
+  description = "Tags | applied everywhere"
+  type        = map(string)
+  default     = { env = "dev" }
+}
+
+variable "name" {}
+
+output "id" {
+  value     = random_id.suffix.hex
+  sensitive = true
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(module), 0644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+
+	files, err := parseModuleFiles([]string{dir})
+	if err != nil {
+		t.Fatalf("Failed to parse module: %v", err)
+	}
+	docs, err := collectModuleDocs(files)
+	if err != nil {
+		t.Fatalf("Failed to collect docs: %v", err)
+	}
+
+	expected := `## Requirements
+
+| Name | Version |
+|------|------|
+| terraform | >= 1.3 |
+| aws | ~> 5.0 |
+
+## Providers
+
+| Name | Source | Version | Aliases |
+|------|------|------|------|
+| aws | hashicorp/aws | ~> 5.0 | us |
+| random | n/a | n/a | n/a |
+
+## Modules
+
+| Name | Source | Version |
+|------|------|------|
+| vpc | ` + "`./vpc`" + ` | n/a |
+
+## Resources
+
+| Name | Mode |
+|------|------|
+| ` + "`data.aws_ami.ubuntu`" + ` | data |
+| ` + "`random_id.suffix`" + ` | managed |
+
+## Inputs
+
+| Name | Description | Type | Default | Required |
+|------|------|------|------|------|
+| name | n/a | ` + "`any`" + ` | n/a | yes |
+| tags | Tags \| applied everywhere | ` + "`map(string)`" + ` | ` + "`{\"env\":\"dev\"}`" + ` | no |
+
+## Outputs
+
+| Name | Description | Sensitive |
+|------|------|------|
+| id | n/a | yes |
+`
+	if actual := docs.Markdown(); actual != expected {
+		t.Errorf("Unexpected docs:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	readme := filepath.Join(dir, "README.md")
+	original := "# Module\n\n" + docsBeginMarker + "\nstale\n" + docsEndMarker + "\n\nFooter\n"
+	if err := os.WriteFile(readme, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write README: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := injectDocs(readme, []byte(expected)); err != nil {
+			t.Fatalf("Failed to inject docs: %v", err)
+		}
+	}
+	injected, err := os.ReadFile(readme)
+	if err != nil {
+		t.Fatalf("Failed to read README: %v", err)
+	}
+	if want := "# Module\n\n" + docsBeginMarker + "\n" + expected + docsEndMarker + "\n\nFooter\n"; string(injected) != want {
+		t.Errorf("Unexpected README after injecting:\n%s", injected)
+	}
+
+	if err := injectDocs(filepath.Join(dir, "main.tf"), []byte(expected)); err == nil {
+		t.Errorf("Expected an error injecting into a file without markers")
+	}
+}
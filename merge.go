@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// mergeIntoFile upserts the generated content into an existing HCL file in place
+func mergeIntoFile(path string, generated *hclwrite.File) error {
+	src, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read merge target: %s", err)
+	}
+
+	existing, diags := hclwrite.ParseConfig(src, path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return fmt.Errorf("unable to parse merge target: %s", diags.Error())
+	}
+
+	mergeBody(existing.Body(), generated.Body(), true)
+
+	if err := os.WriteFile(path, existing.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to write merge target: %s", err)
+	}
+	return nil
+}
+
+// mergeBody replaces attributes and blocks of existing that also occur in generated,
+// appends the ones that don't and leaves everything else, including comments, untouched
+func mergeBody(existing, generated *hclwrite.Body, topLevel bool) {
+	attrs := generated.Attributes()
+	for _, name := range attributesInOrder(generated) {
+		tokens := attrs[name].Expr().BuildTokens(nil)
+		if current := existing.GetAttribute(name); current != nil {
+			if tokensEqual(current.Expr().BuildTokens(nil), tokens) {
+				continue
+			}
+		}
+		existing.SetAttributeRaw(name, tokens)
+	}
+
+	// Blocks are matched on type and labels. When a key occurs exactly once on both
+	// sides the block is merged recursively, otherwise (e.g. repeated unlabeled nested
+	// blocks) all existing blocks with that key are replaced by the generated ones, each
+	// taking the place of the existing block at its position. Generated blocks beyond the
+	// existing ones follow the last of them, existing blocks beyond the generated ones are
+	// removed.
+	generatedBlocks := generated.Blocks()
+	counts := make(map[string]int)
+	for _, block := range generatedBlocks {
+		counts[blockKey(block)]++
+	}
+
+	replaced := make(map[string][]*hclwrite.Block)
+	replacedCount := make(map[string]int)
+	replacements := make(map[*hclwrite.Block][]*hclwrite.Block)
+	appended := make(map[string]bool)
+	for _, block := range generatedBlocks {
+		key := blockKey(block)
+		if matches, ok := replaced[key]; ok {
+			at := matches[len(matches)-1]
+			if index := replacedCount[key]; index < len(matches) {
+				at = matches[index]
+			}
+			replacements[at] = append(replacements[at], block)
+			replacedCount[key]++
+			continue
+		}
+
+		matches := matchingBlocks(existing, key)
+		if !appended[key] && len(matches) == 1 && counts[key] == 1 {
+			mergeBody(matches[0].Body(), block.Body(), false)
+			continue
+		}
+		if !appended[key] && len(matches) > 0 {
+			replaced[key] = matches
+			replacedCount[key] = 1
+			for _, match := range matches {
+				replacements[match] = nil
+			}
+			replacements[matches[0]] = []*hclwrite.Block{block}
+			continue
+		}
+
+		// Keep a blank line between appended top-level blocks and what precedes them
+		if topLevel && len(existing.BuildTokens(nil)) > 0 {
+			existing.AppendNewline()
+		}
+		existing.AppendBlock(block)
+		appended[key] = true
+	}
+
+	if len(replacements) > 0 {
+		replaceBlocks(existing, replacements, topLevel)
+	}
+}
+
+// replaceBlocks writes the blocks replacing each block of body where it is, dropping the
+// blocks replaced by none, and keeps every other token of body as it is. The comments
+// written directly above a replaced block are kept above its replacement.
+func replaceBlocks(body *hclwrite.Body, replacements map[*hclwrite.Block][]*hclwrite.Block, topLevel bool) {
+	starts := make(map[*hclwrite.Token]*hclwrite.Block)
+	for _, block := range body.Blocks() {
+		if _, replaced := replacements[block]; replaced {
+			starts[block.BuildTokens(nil)[0]] = block
+		}
+	}
+
+	// The body has no way to insert blocks, so it is rebuilt from its tokens
+	tokens := body.BuildTokens(nil)
+	var rebuilt hclwrite.Tokens
+	for i := 0; i < len(tokens); i++ {
+		block, replaced := starts[tokens[i]]
+		if !replaced {
+			rebuilt = append(rebuilt, tokens[i])
+			continue
+		}
+		blockTokens := block.BuildTokens(nil)
+		for j, replacement := range replacements[block] {
+			if j == 0 {
+				for _, token := range blockTokens {
+					if token.Type != hclsyntax.TokenComment {
+						break
+					}
+					rebuilt = append(rebuilt, token)
+				}
+			}
+			if j > 0 && topLevel {
+				rebuilt = append(rebuilt, newlineToken())
+			}
+			rebuilt = append(rebuilt, replacement.BuildTokens(nil)...)
+		}
+		i += len(blockTokens) - 1
+	}
+
+	body.Clear()
+	body.AppendUnstructuredTokens(rebuilt)
+}
+
+// attributesInOrder returns the names of the attributes of body in the order they are written
+func attributesInOrder(body *hclwrite.Body) []string {
+	positions := make(map[*hclwrite.Token]int)
+	for i, token := range body.BuildTokens(nil) {
+		positions[token] = i
+	}
+
+	attrs := body.Attributes()
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return positions[attrs[names[i]].BuildTokens(nil)[0]] < positions[attrs[names[j]].BuildTokens(nil)[0]]
+	})
+	return names
+}
+
+// matchingBlocks returns the blocks of body with the given type and labels key
+func matchingBlocks(body *hclwrite.Body, key string) []*hclwrite.Block {
+	var matches []*hclwrite.Block
+	for _, block := range body.Blocks() {
+		if blockKey(block) == key {
+			matches = append(matches, block)
+		}
+	}
+	return matches
+}
+
+// blockKey identifies a block by its type and labels
+func blockKey(block *hclwrite.Block) string {
+	return strings.Join(append([]string{block.Type()}, block.Labels()...), "\x00")
+}
+
+// tokensEqual compares token sequences by their bytes, ignoring spacing
+func tokensEqual(a, b hclwrite.Tokens) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || !bytes.Equal(a[i].Bytes, b[i].Bytes) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// variableDecl is a variable block declared by a module
+type variableDecl struct {
+	Name          string
+	Type          cty.Type
+	TypeSource    string
+	TypeDefaults  *typeexpr.Defaults
+	Default       cty.Value
+	DefaultSource string
+	HasDefault    bool
+	Description   string
+	Sensitive     bool
+	Nullable      bool
+	Validations   []variableValidation
+	Range         hcl.Range
+}
+
+// variableValidation is a validation block inside a variable
+type variableValidation struct {
+	Condition    hcl.Expression
+	ErrorMessage hcl.Expression
+}
+
+// Required reports whether the variable must be set by the caller
+func (v *variableDecl) Required() bool {
+	return !v.HasDefault
+}
+
+var variableBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "type"},
+		{Name: "default"},
+		{Name: "description"},
+		{Name: "sensitive"},
+		{Name: "nullable"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "validation"},
+	},
+}
+
+var validationBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "condition", Required: true},
+		{Name: "error_message"},
+	},
+}
+
+// moduleFiles expands files and directories into the Terraform files they contain
+func moduleFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() && (strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")) {
+				files = append(files, filepath.Join(path, name))
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// parseModuleFiles parses native and JSON Terraform files
+func parseModuleFiles(paths []string) ([]*hcl.File, error) {
+	filenames, err := moduleFiles(paths)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list module files: %s", err)
+	}
+
+	parser := hclparse.NewParser()
+	var files []*hcl.File
+	for _, filename := range filenames {
+		var file *hcl.File
+		var diags hcl.Diagnostics
+		if strings.HasSuffix(filename, ".json") {
+			file, diags = parser.ParseJSONFile(filename)
+		} else {
+			file, diags = parser.ParseHCLFile(filename)
+		}
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("unable to parse %s: %s", filename, diags.Error())
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// loadModuleVariables parses the variable blocks of the given files and directories
+func loadModuleVariables(paths []string) ([]*variableDecl, error) {
+	files, err := parseModuleFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	return fileVariables(files)
+}
+
+// fileVariables decodes the variable blocks of already parsed files
+func fileVariables(files []*hcl.File) ([]*variableDecl, error) {
+	var variables []*variableDecl
+	for _, file := range files {
+		content, _, diags := file.Body.PartialContent(&hcl.BodySchema{
+			Blocks: []hcl.BlockHeaderSchema{{Type: "variable", LabelNames: []string{"name"}}},
+		})
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("unable to read variables: %s", diags.Error())
+		}
+
+		for _, block := range content.Blocks {
+			variable, err := decodeVariableBlock(block, file.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			variables = append(variables, variable)
+		}
+	}
+
+	return variables, nil
+}
+
+// decodeVariableBlock reads a single variable block
+func decodeVariableBlock(block *hcl.Block, src []byte) (*variableDecl, error) {
+	variable := &variableDecl{
+		Name:     block.Labels[0],
+		Type:     cty.DynamicPseudoType,
+		Nullable: true,
+		Range:    block.DefRange,
+	}
+
+	content, _, diags := block.Body.PartialContent(variableBlockSchema)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to read variable %q: %s", variable.Name, diags.Error())
+	}
+
+	if attr, ok := content.Attributes["type"]; ok {
+		expr, source, err := typeExpression(attr.Expr, src)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %s", variable.Name, err)
+		}
+		ty, defaults, diags := typeexpr.TypeConstraintWithDefaults(expr)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q has an invalid type: %s", variable.Name, diags.Error())
+		}
+		variable.Type, variable.TypeDefaults, variable.TypeSource = ty, defaults, source
+	}
+
+	if attr, ok := content.Attributes["default"]; ok {
+		variable.HasDefault = true
+		variable.DefaultSource = string(attr.Expr.Range().SliceBytes(src))
+		if val, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+			variable.Default = val
+		}
+	}
+
+	for name, target := range map[string]*bool{"sensitive": &variable.Sensitive, "nullable": &variable.Nullable} {
+		if attr, ok := content.Attributes[name]; ok {
+			val, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !val.Type().Equals(cty.Bool) || val.IsNull() {
+				return nil, fmt.Errorf("variable %q: %s must be true or false", variable.Name, name)
+			}
+			*target = val.True()
+		}
+	}
+
+	if attr, ok := content.Attributes["description"]; ok {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || !val.Type().Equals(cty.String) || val.IsNull() {
+			return nil, fmt.Errorf("variable %q: description must be a string", variable.Name)
+		}
+		variable.Description = val.AsString()
+	}
+
+	for _, validation := range content.Blocks {
+		validationContent, diags := validation.Body.Content(validationBlockSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q has an invalid validation block: %s", variable.Name, diags.Error())
+		}
+		v := variableValidation{Condition: validationContent.Attributes["condition"].Expr}
+		if attr, ok := validationContent.Attributes["error_message"]; ok {
+			v.ErrorMessage = attr.Expr
+		}
+		variable.Validations = append(variable.Validations, v)
+	}
+
+	return variable, nil
+}
+
+// typeExpression returns a type constraint as native syntax, parsing the string
+// form used by Terraform's JSON syntax when needed
+func typeExpression(expr hcl.Expression, src []byte) (hcl.Expression, string, error) {
+	if _, isNative := expr.(hclsyntax.Expression); isNative {
+		return expr, string(expr.Range().SliceBytes(src)), nil
+	}
+
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || !val.Type().Equals(cty.String) || val.IsNull() {
+		return nil, "", fmt.Errorf("type must be a type constraint string")
+	}
+
+	source := val.AsString()
+	native, diags := hclsyntax.ParseExpression([]byte(source), expr.Range().Filename, expr.Range().Start)
+	if diags.HasErrors() {
+		return nil, "", fmt.Errorf("invalid type %q: %s", source, diags.Error())
+	}
+	return native, source, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// invalidNameError reports a JSON key that can't be an attribute or block name in native
+// syntax, such as "kubernetes.io/cluster/prod", "123abc" or "my key"
+type invalidNameError struct {
+	name  string
+	where string
+}
+
+func (e *invalidNameError) Error() string {
+	return fmt.Sprintf("%q %s is not a valid attribute or block name, names must be identifiers; keys like this can only be written inside a map value", e.name, e.where)
+}
+
+// checkBodyKeys returns an invalidNameError for the first key of a block body that isn't a
+// valid identifier. An empty blockType stands for the top level of the file.
+func checkBodyKeys(content map[string]cty.Value, blockType string, labels []string) error {
+	for _, name := range sortedValueKeys(content) {
+		if err := checkName(name, blockType, labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkName returns an invalidNameError when name isn't a valid identifier
+func checkName(name string, blockType string, labels []string) error {
+	if hclsyntax.ValidIdentifier(name) {
+		return nil
+	}
+
+	where := "at the top level"
+	if blockType != "" {
+		header := []string{blockType}
+		for _, label := range labels {
+			header = append(header, strconv.Quote(label))
+		}
+		where = "in " + strings.Join(header, " ")
+	}
+	return &invalidNameError{name: name, where: where}
+}
+
+// mustBeBlock reports whether a failed block conversion has to fail the whole conversion,
+// because the key is an invalid name that can't be written as a map attribute either: a
+// known, declared or spec block type holds blocks, never a map
+func mustBeBlock(decision blockDecision, err error) bool {
+	var invalidName *invalidNameError
+	if !errors.As(err, &invalidName) {
+		return false
+	}
+	return decision.reason != reasonStructure && decision.reason != reasonValueShape
+}
+
+// convertBlocksOrRollback runs a block conversion that appends to nativeBody, removing the
+// blocks it appended and the decisions it recorded when it fails
+func convertBlocksOrRollback(nativeBody *hclwrite.Body, convertBlocks func() error) error {
+	blockCount := len(nativeBody.Blocks())
+	entryCount := 0
+	if explainer != nil {
+		entryCount = len(explainer.entries)
+	}
+
+	err := convertBlocks()
+	if err == nil {
+		return nil
+	}
+
+	for _, block := range nativeBody.Blocks()[blockCount:] {
+		nativeBody.RemoveBlock(block)
+	}
+	if explainer != nil {
+		for _, entry := range explainer.entries[entryCount:] {
+			delete(explainer.seen, entry)
+		}
+		explainer.entries = explainer.entries[:entryCount]
+	}
+	return err
+}
+
+// valueTokens returns the tokens of a constant value like hclwrite.TokensForValue, also
+// quoting object keys that read as a keyword: a leading `for` key would start a for expression.
+// Numbers marked with their numberLiteral keep that text.
+func valueTokens(val cty.Value) hclwrite.Tokens {
+	unmarked, _ := val.UnmarkDeep()
+	tokens := hclwrite.TokensForValue(unmarked)
+	if val.ContainsMarked() {
+		tokens = numberLiteralTokens(tokens, val)
+	}
+	quoted := make(hclwrite.Tokens, 0, len(tokens))
+	for i, token := range tokens {
+		isKey := i+1 < len(tokens) && tokens[i+1].Type == hclsyntax.TokenEqual
+		if token.Type == hclsyntax.TokenIdent && isKey && string(token.Bytes) == "for" {
+			quoted = append(quoted,
+				&hclwrite.Token{Type: hclsyntax.TokenOQuote, Bytes: []byte(`"`)},
+				&hclwrite.Token{Type: hclsyntax.TokenQuotedLit, Bytes: token.Bytes},
+				&hclwrite.Token{Type: hclsyntax.TokenCQuote, Bytes: []byte(`"`)},
+			)
+			continue
+		}
+		quoted = append(quoted, token)
+	}
+	return quoted
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kvz/json2hcl/convert"
+)
+
+// jsonBlockSchema describes a block type of Terraform JSON: its number of labels and which
+// keys of its body are nested blocks
+type jsonBlockSchema struct {
+	labels int
+	blocks map[string]*jsonBlockSchema
+	// providerBlocks is set for bodies that also hold nested blocks defined by provider
+	// schemas, like resources. Terraform defines every nested block of other bodies.
+	providerBlocks bool
+}
+
+var (
+	conditionBlockSchema = &jsonBlockSchema{}
+	lifecycleSchema      = &jsonBlockSchema{blocks: map[string]*jsonBlockSchema{
+		"precondition":  conditionBlockSchema,
+		"postcondition": conditionBlockSchema,
+	}}
+	connectionSchema = &jsonBlockSchema{}
+	dynamicSchema    = &jsonBlockSchema{labels: 1, blocks: map[string]*jsonBlockSchema{
+		"content": {providerBlocks: true},
+	}}
+	resourceSchema = &jsonBlockSchema{labels: 2, providerBlocks: true, blocks: map[string]*jsonBlockSchema{
+		"connection": connectionSchema,
+		"dynamic":    dynamicSchema,
+		"lifecycle":  lifecycleSchema,
+		"provisioner": {labels: 1, blocks: map[string]*jsonBlockSchema{
+			"connection": connectionSchema,
+		}},
+	}}
+)
+
+func init() {
+	// Dynamic blocks can generate nested blocks dynamically too
+	dynamicSchema.blocks["content"].blocks = map[string]*jsonBlockSchema{"dynamic": dynamicSchema}
+}
+
+// terraformJSONSchema lists the block types of Terraform's JSON syntax whose shape is known
+// without provider schemas
+var terraformJSONSchema = &jsonBlockSchema{blocks: map[string]*jsonBlockSchema{
+	"check": {labels: 1, blocks: map[string]*jsonBlockSchema{
+		"assert": {},
+		"data":   {labels: 2, providerBlocks: true},
+	}},
+	"data":   resourceSchema,
+	"import": {},
+	"locals": {},
+	"module": {labels: 1},
+	"moved":  {},
+	"output": {labels: 1, blocks: map[string]*jsonBlockSchema{
+		"precondition": conditionBlockSchema,
+	}},
+	"provider": {labels: 1, providerBlocks: true, blocks: map[string]*jsonBlockSchema{
+		"dynamic": dynamicSchema,
+	}},
+	"removed":  {blocks: map[string]*jsonBlockSchema{"lifecycle": {}}},
+	"resource": resourceSchema,
+	"terraform": {blocks: map[string]*jsonBlockSchema{
+		"backend":            {labels: 1},
+		"cloud":              {blocks: map[string]*jsonBlockSchema{"workspaces": {}}},
+		"provider_meta":      {labels: 1},
+		"required_providers": {},
+	}},
+	"variable": {labels: 1, blocks: map[string]*jsonBlockSchema{
+		"validation": conditionBlockSchema,
+	}},
+}}
+
+// runNormalize implements the `normalize` command
+func runNormalize(args []string) error {
+	flags := flag.NewFlagSet("normalize", flag.ExitOnError)
+	blockTypes := flags.String("block-types", "", "Comma separated keys that are blocks at any level, each optionally with its label count (e.g. ebs_block_device,setting:1)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: json2hcl normalize [-block-types list] [file.tf.json] < file.tf.json")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	declared, err := parseBlockTypes(*blockTypes)
+	if err != nil {
+		return err
+	}
+
+	var input []byte
+	switch flags.NArg() {
+	case 0:
+		input, err = io.ReadAll(os.Stdin)
+	case 1:
+		input, err = os.ReadFile(flags.Arg(0))
+	default:
+		flags.Usage()
+		return fmt.Errorf("normalize takes at most one file")
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read input: %s", err)
+	}
+
+	normalized, err := normalizeTerraformJSON(input, declared)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, normalized, "", "  "); err != nil {
+		return fmt.Errorf("unable to format JSON: %s", err)
+	}
+	fmt.Println(out.String())
+	return nil
+}
+
+// normalizeTerraformJSON rewrites Terraform JSON into one canonical shape: labels are
+// nested objects and every block body is an element of an array, e.g.
+// {"resource": {"aws_instance": {"web": [{...}]}}}. Labeled blocks nested in other blocks,
+// like provisioner or dynamic, are an array of label objects in their original order, e.g.
+// "provisioner": [{"file": [{...}]}, {"local-exec": [{...}]}]. Blocks may be written as
+// objects or arrays of objects at any label level. Keys whose shape is unknown are left
+// untouched, and object keys are sorted.
+func normalizeTerraformJSON(input []byte, declared map[string]int) ([]byte, error) {
+	decoded, err := decodeJSON(input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON: %s", err)
+	}
+	body, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Terraform JSON must be an object")
+	}
+
+	n := &normalizer{declared: declared}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(n.body(body, terraformJSONSchema)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// normalizer holds the block types declared in addition to the known Terraform ones
+type normalizer struct {
+	declared map[string]int
+}
+
+// blockSchema returns the schema of key inside a body of the given schema, or nil when
+// key is not a block
+func (n *normalizer) blockSchema(parent *jsonBlockSchema, key string) *jsonBlockSchema {
+	if schema, ok := parent.blocks[key]; ok {
+		return schema
+	}
+	if labels, ok := n.declared[key]; ok {
+		return &jsonBlockSchema{labels: labels}
+	}
+	return nil
+}
+
+// body normalizes the nested blocks of a block body
+func (n *normalizer) body(body map[string]interface{}, schema *jsonBlockSchema) map[string]interface{} {
+	out := make(map[string]interface{}, len(body))
+	for key, value := range body {
+		out[key] = value
+	}
+
+	// In the block list encoding every other key is an attribute
+	if blocks, ok := body[convert.BlockListKey].([]interface{}); ok {
+		for _, entry := range blocks {
+			entryObj, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			blockType, _ := entryObj["type"].(string)
+			entryBody, isBody := entryObj["body"].(map[string]interface{})
+			if blockSchema := n.blockSchema(schema, blockType); blockSchema != nil && isBody {
+				entryObj["body"] = n.body(entryBody, blockSchema)
+			}
+		}
+		return out
+	}
+
+	for key, value := range body {
+		blockSchema := n.blockSchema(schema, key)
+		if blockSchema == nil {
+			continue
+		}
+		if blockSchema.labels > 0 && schema != terraformJSONSchema {
+			if normalized, ok := n.orderedBlocks(value, blockSchema); ok {
+				out[key] = normalized
+			}
+			continue
+		}
+		if normalized, ok := n.blocks(value, blockSchema.labels, blockSchema); ok {
+			out[key] = normalized
+		}
+	}
+	return out
+}
+
+// orderedBlocks normalizes the value of a nested labeled block type key to an array of label
+// objects, so blocks whose order matters, like provisioners, keep it
+func (n *normalizer) orderedBlocks(value interface{}, schema *jsonBlockSchema) (interface{}, bool) {
+	elems := []interface{}{value}
+	if list, isList := value.([]interface{}); isList {
+		elems = list
+	}
+
+	ordered := make([]interface{}, 0, len(elems))
+	for _, elem := range elems {
+		if _, isObject := elem.(map[string]interface{}); !isObject {
+			return value, false
+		}
+		normalized, ok := n.blocks(elem, schema.labels, schema)
+		if !ok {
+			return value, false
+		}
+		ordered = append(ordered, normalized)
+	}
+	return ordered, true
+}
+
+// blocks normalizes the value of a block type key with the given number of labels still to
+// come. It reports false, leaving the value as it is, when the value has an unexpected shape.
+func (n *normalizer) blocks(value interface{}, labels int, schema *jsonBlockSchema) (interface{}, bool) {
+	var objects []map[string]interface{}
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		objects = []map[string]interface{}{typed}
+	case []interface{}:
+		for _, elem := range typed {
+			obj, ok := elem.(map[string]interface{})
+			if !ok {
+				return value, false
+			}
+			objects = append(objects, obj)
+		}
+	default:
+		return value, false
+	}
+
+	if labels == 0 {
+		bodies := make([]interface{}, 0, len(objects))
+		for _, obj := range objects {
+			bodies = append(bodies, n.body(obj, schema))
+		}
+		return bodies, true
+	}
+
+	// Merge the label objects, keeping the order of blocks that share labels
+	merged := make(map[string]interface{})
+	for _, obj := range objects {
+		for label, nested := range obj {
+			normalized, ok := n.blocks(nested, labels-1, schema)
+			if !ok {
+				return value, false
+			}
+			merged[label] = mergeNormalizedBlocks(merged[label], normalized)
+		}
+	}
+	return merged, true
+}
+
+// mergeNormalizedBlocks combines two normalized values found under the same labels
+func mergeNormalizedBlocks(existing, added interface{}) interface{} {
+	switch typed := existing.(type) {
+	case []interface{}:
+		if addedList, ok := added.([]interface{}); ok {
+			return append(typed, addedList...)
+		}
+	case map[string]interface{}:
+		if addedObj, ok := added.(map[string]interface{}); ok {
+			for key, value := range addedObj {
+				typed[key] = mergeNormalizedBlocks(typed[key], value)
+			}
+			return typed
+		}
+	}
+	return added
+}
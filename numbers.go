@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// numberLiteral marks a number whose JSON text, such as 1.0, 1e3 or 0.10, is not how cty
+// would print it, so the HCL keeps the text as written
+type numberLiteral string
+
+// withNumberLiterals marks the numbers of val whose text in raw, the same value decoded by
+// decodeJSON, wouldn't survive being printed from the cty number
+func withNumberLiterals(val cty.Value, raw interface{}) cty.Value {
+	if val.IsNull() || !val.IsKnown() || val.IsMarked() {
+		return val
+	}
+
+	switch raw := raw.(type) {
+	case json.Number:
+		if val.Type() == cty.Number && val.AsBigFloat().Text('f', -1) != raw.String() {
+			return val.Mark(numberLiteral(raw))
+		}
+	case map[string]interface{}:
+		if !val.Type().IsObjectType() {
+			return val
+		}
+		attrs := val.AsValueMap()
+		for name, attr := range attrs {
+			attrs[name] = withNumberLiterals(attr, raw[name])
+		}
+		if len(attrs) > 0 {
+			return cty.ObjectVal(attrs)
+		}
+	case []interface{}:
+		if !val.Type().IsTupleType() || val.LengthInt() != len(raw) {
+			return val
+		}
+		elems := val.AsValueSlice()
+		for i, elem := range elems {
+			elems[i] = withNumberLiterals(elem, raw[i])
+		}
+		if len(elems) > 0 {
+			return cty.TupleVal(elems)
+		}
+	}
+	return val
+}
+
+// numberLiteralTokens replaces the number tokens written for the marked numbers of val,
+// which tokens were generated from, with their original text
+func numberLiteralTokens(tokens hclwrite.Tokens, val cty.Value) hclwrite.Tokens {
+	// hclwrite writes every number as a single token, in the order of a depth-first walk
+	var literals []string
+	cty.Walk(val, func(_ cty.Path, v cty.Value) (bool, error) {
+		if v.Type() == cty.Number && !v.IsNull() {
+			literal := ""
+			for mark := range v.Marks() {
+				if text, ok := mark.(numberLiteral); ok {
+					literal = string(text)
+				}
+			}
+			literals = append(literals, literal)
+		}
+		return true, nil
+	})
+
+	next := 0
+	for _, token := range tokens {
+		if token.Type != hclsyntax.TokenNumberLit || next >= len(literals) {
+			continue
+		}
+		if literals[next] != "" {
+			token.Bytes = []byte(literals[next])
+		}
+		next++
+	}
+	return tokens
+}
+
+// sameNumber reports whether two JSON numbers have exactly the same decimal value
+func sameNumber(a, b json.Number) bool {
+	x, okX := new(big.Rat).SetString(a.String())
+	y, okY := new(big.Rat).SetString(b.String())
+	if !okX || !okY {
+		return a == b
+	}
+	return x.Cmp(y) == 0
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/kvz/json2hcl/convert"
+)
+
+// runPatch implements the `patch` command
+func runPatch(args []string) error {
+	flags := flag.NewFlagSet("patch", flag.ExitOnError)
+	patchFile := flags.String("patch", "", "JSON Patch (RFC 6902, an array) or JSON Merge Patch (RFC 7386, an object) document to apply")
+	stdout := flags.Bool("stdout", false, "Print the patched file instead of writing it in place")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: json2hcl patch -patch <patch.json> <file.tf>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *patchFile == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("patch requires -patch and at least one file")
+	}
+
+	patchBytes, err := os.ReadFile(*patchFile)
+	if err != nil {
+		return fmt.Errorf("unable to read patch: %s", err)
+	}
+	patch, err := decodeJSON(patchBytes)
+	if err != nil {
+		return fmt.Errorf("unable to parse patch: %s", err)
+	}
+
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %s", filename, err)
+		}
+
+		targetFileType = getFileType(filename)
+		patched, err := patchHCL(src, filename, patch)
+		if err != nil {
+			return fmt.Errorf("unable to patch %s: %s", filename, err)
+		}
+
+		if *stdout {
+			fmt.Print(string(patched))
+			continue
+		}
+		if err := os.WriteFile(filename, patched, 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %s", filename, err)
+		}
+	}
+
+	return nil
+}
+
+// decodeJSON decodes JSON keeping numbers as json.Number so they round-trip exactly
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// hclModel returns the JSON representation convert.ConvertFile produces for a parsed file
+func hclModel(file *hcl.File) (map[string]interface{}, error) {
+	jsonBytes, err := convert.File(file, convert.Options{Terraform: targetFileType == "terraform"})
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := decodeJSON(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
+	return model.(map[string]interface{}), nil
+}
+
+// patchHCL applies a JSON Patch or JSON Merge Patch, addressed against the convert JSON
+// model, to HCL source. Only attributes and blocks whose value changed are rewritten;
+// every other byte of src is kept as is.
+func patchHCL(src []byte, filename string, patch interface{}) ([]byte, error) {
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parse config: %s", diags.Error())
+	}
+
+	oldModel, err := hclModel(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var newModel interface{}
+	switch typed := patch.(type) {
+	case []interface{}:
+		newModel, err = applyJSONPatch(deepCopyJSON(oldModel), typed)
+	case map[string]interface{}:
+		newModel = applyMergePatch(deepCopyJSON(oldModel), typed)
+	default:
+		err = fmt.Errorf("patch must be a JSON Patch array or a JSON Merge Patch object")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	newObj, ok := newModel.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("patched document must remain an object")
+	}
+
+	p := &hclPatcher{src: src}
+	if err := p.diffBody(file.Body.(*hclsyntax.Body), "", oldModel, newObj, "", len(src), true); err != nil {
+		return nil, err
+	}
+
+	patched := p.apply()
+	if _, diags := hclparse.NewParser().ParseHCL(patched, filename); diags.HasErrors() {
+		return nil, fmt.Errorf("patched result is not valid HCL: %s", diags.Error())
+	}
+	return patched, nil
+}
+
+// textEdit replaces src[start:end] with text
+type textEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// hclPatcher collects text edits against the original source
+type hclPatcher struct {
+	src   []byte
+	edits []textEdit
+}
+
+func (p *hclPatcher) edit(start, end int, text string) {
+	p.edits = append(p.edits, textEdit{start: start, end: end, text: text})
+}
+
+// apply returns the source with all edits applied. Edits at the same offset keep the
+// order in which they were recorded.
+func (p *hclPatcher) apply() []byte {
+	order := make([]int, len(p.edits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := p.edits[order[i]], p.edits[order[j]]
+		if a.start != b.start {
+			return a.start > b.start
+		}
+		return order[i] > order[j]
+	})
+
+	out := append([]byte(nil), p.src...)
+	for _, i := range order {
+		e := p.edits[i]
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+	}
+	return out
+}
+
+// diffBody records the edits needed to turn body, the body of a blockType block represented
+// by oldObj, into newObj. New content is inserted at offset insertAt with the given indentation.
+func (p *hclPatcher) diffBody(body *hclsyntax.Body, blockType string, oldObj, newObj map[string]interface{}, indent string, insertAt int, topLevel bool) error {
+	blocksByType := make(map[string][]*hclsyntax.Block)
+	for _, block := range body.Blocks {
+		blocksByType[block.Type] = append(blocksByType[block.Type], block)
+	}
+
+	keys := make([]string, 0, len(oldObj)+len(newObj))
+	for key := range oldObj {
+		keys = append(keys, key)
+	}
+	for key := range newObj {
+		if _, exists := oldObj[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		newVal, inNew := newObj[key]
+
+		if attr, ok := body.Attributes[key]; ok {
+			if !inNew {
+				p.removeLines(attr.SrcRange)
+			} else if !jsonEqual(oldObj[key], newVal) {
+				text, err := renderAttribute(key, blockType, newVal, indent)
+				if err != nil {
+					return err
+				}
+				// Only the expression is replaced so the name and its alignment stay as they are
+				_, expr, _ := strings.Cut(text, "=")
+				p.edit(attr.Expr.Range().Start.Byte, attr.SrcRange.End.Byte, strings.TrimLeft(expr, " "))
+			}
+			continue
+		}
+
+		if blocks := blocksByType[key]; len(blocks) > 0 {
+			if err := p.diffBlocks(key, blockType, blocks, oldObj[key], newVal, inNew, indent, insertAt, topLevel); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if inNew {
+			text, err := renderContent(key, blockType, newVal, indent)
+			if err != nil {
+				return err
+			}
+			p.insert(insertAt, text, topLevel && strings.Contains(text, "{\n"))
+		}
+	}
+
+	return nil
+}
+
+// diffBlocks records the edits for all blocks of one type within a parentType body
+func (p *hclPatcher) diffBlocks(blockType, parentType string, blocks []*hclsyntax.Block, oldVal, newVal interface{}, inNew bool, indent string, insertAt int, topLevel bool) error {
+	if !inNew {
+		for _, block := range blocks {
+			p.removeLines(block.Range())
+		}
+		return nil
+	}
+
+	depth := len(blocks[0].Labels)
+	oldEntries, _ := collectBlockEntries(oldVal, depth, nil)
+	newEntries, ok := collectBlockEntries(newVal, depth, nil)
+	if !ok {
+		// The value no longer has the shape of these blocks, start over from the new value
+		for _, block := range blocks {
+			p.removeLines(block.Range())
+		}
+		text, err := renderContent(blockType, parentType, newVal, indent)
+		if err != nil {
+			return err
+		}
+		p.insert(insertAt, text, topLevel)
+		return nil
+	}
+
+	seen := make(map[string]int)
+	for _, block := range blocks {
+		key := strings.Join(block.Labels, "\x00")
+		index := seen[key]
+		seen[key]++
+
+		entry := newEntries.get(key)
+		if entry == nil || index >= len(entry.bodies) {
+			p.removeLines(block.Range())
+			continue
+		}
+
+		oldBody, _ := oldEntries.get(key).bodies[index].(map[string]interface{})
+		newBody, ok := entry.bodies[index].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("body of %s block %q must be an object", blockType, block.Labels)
+		}
+		if jsonEqual(oldBody, newBody) {
+			continue
+		}
+
+		blockIndent := lineIndent(p.src, block.Range().Start.Byte)
+		closeLine := lineStart(p.src, block.CloseBraceRange.Start.Byte)
+		if strings.TrimSpace(string(p.src[closeLine:block.CloseBraceRange.Start.Byte])) != "" {
+			// Single line blocks have nowhere to insert into, so render them again
+			text, err := renderPatchBlock(blockType, block.Labels, newBody, blockIndent)
+			if err != nil {
+				return err
+			}
+			r := block.Range()
+			p.edit(r.Start.Byte, r.End.Byte, strings.TrimSuffix(strings.TrimPrefix(text, blockIndent), "\n"))
+			continue
+		}
+
+		if err := p.diffBody(block.Body, blockType, oldBody, newBody, blockIndent+"  ", closeLine, false); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range newEntries {
+		for _, body := range entry.bodies[seen[strings.Join(entry.labels, "\x00")]:] {
+			bodyObj, ok := body.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("body of %s block %q must be an object", blockType, entry.labels)
+			}
+			text, err := renderPatchBlock(blockType, entry.labels, bodyObj, indent)
+			if err != nil {
+				return err
+			}
+			p.insert(insertAt, text, topLevel)
+		}
+	}
+
+	return nil
+}
+
+// insert adds text at offset, optionally separated from preceding content by a blank line
+func (p *hclPatcher) insert(offset int, text string, separate bool) {
+	if offset > 0 && p.src[offset-1] != '\n' {
+		text = "\n" + text
+	}
+	if separate && offset > 0 {
+		text = "\n" + text
+	}
+	p.edit(offset, offset, text)
+}
+
+// removeLines removes the lines spanned by r, including trailing comments
+func (p *hclPatcher) removeLines(r hcl.Range) {
+	start := lineStart(p.src, r.Start.Byte)
+	end := r.End.Byte
+	for end < len(p.src) && p.src[end] != '\n' {
+		end++
+	}
+	if end < len(p.src) {
+		end++
+	}
+	p.edit(start, end, "")
+}
+
+// blockEntry is one label path of a block type with its bodies
+type blockEntry struct {
+	labels []string
+	bodies []interface{}
+}
+
+type blockEntries []*blockEntry
+
+func (entries blockEntries) get(key string) *blockEntry {
+	for _, entry := range entries {
+		if strings.Join(entry.labels, "\x00") == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+// collectBlockEntries walks the labels-as-keys nesting of a block type down to its bodies
+func collectBlockEntries(value interface{}, depth int, labels []string) (blockEntries, bool) {
+	if depth == 0 {
+		switch typed := value.(type) {
+		case []interface{}:
+			return blockEntries{{labels: labels, bodies: typed}}, true
+		case map[string]interface{}:
+			return blockEntries{{labels: labels, bodies: []interface{}{typed}}}, true
+		default:
+			return nil, false
+		}
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var entries blockEntries
+	for _, key := range keys {
+		nested, ok := collectBlockEntries(obj[key], depth-1, append(append([]string(nil), labels...), key))
+		if !ok {
+			return nil, false
+		}
+		entries = append(entries, nested...)
+	}
+	return entries, true
+}
+
+// jsonToCty decodes a JSON value the same way the forward conversion reads attributes
+func jsonToCty(value interface{}) (cty.Value, error) {
+	wrapped, err := json.Marshal(map[string]interface{}{"value": value})
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	file, diags := hclparse.NewParser().ParseJSON(wrapped, "<patch>")
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("%s", diags.Error())
+	}
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("%s", diags.Error())
+	}
+	val, diags := attrs["value"].Expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("%s", diags.Error())
+	}
+	return val, nil
+}
+
+// renderAttribute renders a single attribute of a blockType block the way the forward
+// conversion would
+func renderAttribute(name, blockType string, value interface{}, indent string) (string, error) {
+	val, err := jsonToCty(value)
+	if err != nil {
+		return "", err
+	}
+	val = withNumberLiterals(val, value)
+
+	file := hclwrite.NewEmptyFile()
+	setAttributeWithExpressionHandling(file.Body(), name, val)
+	if targetFileType == "terraform" {
+		bareReferences(file.Body(), blockType)
+		bareTypeConstraints(file.Body(), blockType)
+	}
+	return strings.TrimSuffix(indentText(hclwrite.Format(file.Bytes()), indent), "\n"), nil
+}
+
+// renderPatchBlock renders a block with the given labels and body
+func renderPatchBlock(blockType string, labels []string, body map[string]interface{}, indent string) (string, error) {
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	content, err := jsonToNativeFile(bodyJSON, "<patch>")
+	if err != nil {
+		return "", err
+	}
+	if targetFileType == "terraform" {
+		bareReferences(content.Body(), blockType)
+		bareTypeConstraints(content.Body(), blockType)
+	}
+
+	file := hclwrite.NewEmptyFile()
+	block := file.Body().AppendNewBlock(blockType, labels)
+	block.Body().AppendUnstructuredTokens(content.BuildTokens(nil))
+	return indentText(hclwrite.Format(file.Bytes()), indent), nil
+}
+
+// renderContent renders a new key of a blockType body, letting the forward conversion
+// decide whether it becomes an attribute or blocks
+func renderContent(key, blockType string, value interface{}, indent string) (string, error) {
+	contentJSON, err := json.Marshal(map[string]interface{}{key: value})
+	if err != nil {
+		return "", err
+	}
+	content, err := jsonToNativeFile(contentJSON, "<patch>")
+	if err != nil {
+		return "", err
+	}
+	if targetFileType == "terraform" {
+		bareReferences(content.Body(), blockType)
+		bareTypeConstraints(content.Body(), blockType)
+	}
+	return indentText(hclwrite.Format(content.Bytes()), indent), nil
+}
+
+// indentText prefixes every non-empty line with indent
+func indentText(text []byte, indent string) string {
+	lines := strings.SplitAfter(string(text), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// lineStart returns the offset of the first byte of the line containing offset
+func lineStart(src []byte, offset int) int {
+	for offset > 0 && src[offset-1] != '\n' {
+		offset--
+	}
+	return offset
+}
+
+// lineIndent returns the leading whitespace of the line containing offset
+func lineIndent(src []byte, offset int) string {
+	start := lineStart(src, offset)
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
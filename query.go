@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/kvz/json2hcl/convert"
+)
+
+// runQuery implements the `query` command
+func runQuery(args []string) error {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	format := flags.String("format", "json", "Output format for each match: json, hcl (expression source) or location")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: json2hcl query [-format json|hcl|location] <path> [file.tf...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	switch *format {
+	case "json", "hcl", "location":
+	default:
+		return fmt.Errorf("unknown query format %q, expected json, hcl or location", *format)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("query requires a path")
+	}
+
+	path, err := parseQueryPath(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	type source struct {
+		filename string
+		src      []byte
+	}
+	var sources []source
+	if flags.NArg() == 1 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("unable to read from stdin: %s", err)
+		}
+		sources = append(sources, source{"<stdin>", src})
+	}
+	for _, filename := range flags.Args()[1:] {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %s", filename, err)
+		}
+		sources = append(sources, source{filename, src})
+	}
+
+	for _, source := range sources {
+		root, err := parseQueryTree(source.src, source.filename)
+		if err != nil {
+			return err
+		}
+
+		for _, match := range root.query(path) {
+			output, err := match.render(*format, source.src)
+			if err != nil {
+				return err
+			}
+			fmt.Println(output)
+		}
+	}
+
+	return nil
+}
+
+// queryNode is a part of the JSON model produced by the convert package, remembering the
+// source range it came from
+type queryNode struct {
+	keys     []string
+	members  map[string]*queryNode
+	elements []*queryNode
+	isList   bool
+	value    interface{}
+	rng      hcl.Range
+}
+
+func newObjectNode(rng hcl.Range) *queryNode {
+	return &queryNode{members: make(map[string]*queryNode), rng: rng}
+}
+
+func (n *queryNode) isObject() bool {
+	return n.members != nil
+}
+
+func (n *queryNode) setMember(key string, child *queryNode) {
+	if _, exists := n.members[key]; !exists {
+		n.keys = append(n.keys, key)
+	}
+	n.members[key] = child
+}
+
+// parseQueryTree parses HCL source into a query tree over the JSON -reverse writes for it
+func parseQueryTree(src []byte, filename string) (*queryNode, error) {
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to parse HCL: %s", diags.Error())
+	}
+
+	model, err := convert.ConvertFileOrdered(file, convert.Options{Terraform: getFileType(filename) == "terraform"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert HCL: %s", err)
+	}
+
+	body := file.Body.(*hclsyntax.Body)
+	return buildQueryNode(model, querySource{rng: body.SrcRange, body: body}, src), nil
+}
+
+// buildQueryNode builds the node for a value of the JSON model, which source came from
+func buildQueryNode(value interface{}, source querySource, src []byte) *queryNode {
+	switch typed := value.(type) {
+	case *convert.Object:
+		node := newObjectNode(source.rng)
+		node.value = typed
+		for _, key := range typed.Keys() {
+			member, _ := typed.Get(key)
+			node.setMember(key, buildQueryNode(member, source.member(key, src), src))
+		}
+		return node
+	case []interface{}:
+		node := &queryNode{isList: true, value: typed, rng: source.rng}
+		for i, elem := range typed {
+			node.elements = append(node.elements, buildQueryNode(elem, source.element(i), src))
+		}
+		return node
+	default:
+		return &queryNode{value: value, rng: source.rng}
+	}
+}
+
+// querySource is the HCL a value of the JSON model was converted from: a body, the blocks
+// of one type whose first depth labels are nested keys already, or an expression
+type querySource struct {
+	rng    hcl.Range
+	body   *hclsyntax.Body
+	blocks []*hclsyntax.Block
+	depth  int
+	expr   hclsyntax.Expression
+}
+
+// member returns the source of the value of key in the object converted from s. Keys that
+// have no source of their own, like the ordered block list, get the range of s.
+func (s querySource) member(key string, src []byte) querySource {
+	switch {
+	case s.body != nil:
+		if attr, ok := s.body.Attributes[key]; ok {
+			return querySource{rng: attr.Expr.Range(), expr: attr.Expr}
+		}
+		var blocks []*hclsyntax.Block
+		for _, block := range s.body.Blocks {
+			if block.Type == key {
+				blocks = append(blocks, block)
+			}
+		}
+		if len(blocks) > 0 {
+			return querySource{rng: blocks[0].Range(), blocks: blocks}
+		}
+	case len(s.blocks) > 0 && s.depth < len(s.blocks[0].Labels):
+		var blocks []*hclsyntax.Block
+		for _, block := range s.blocks {
+			if block.Labels[s.depth] == key {
+				blocks = append(blocks, block)
+			}
+		}
+		if len(blocks) > 0 {
+			return querySource{rng: blocks[0].Range(), blocks: blocks, depth: s.depth + 1}
+		}
+	case len(s.blocks) > 0:
+		// A block written as an object rather than an array of bodies
+		return querySource{rng: s.blocks[0].Range(), body: s.blocks[0].Body}.member(key, src)
+	case s.expr != nil:
+		if object, ok := s.expr.(*hclsyntax.ObjectConsExpr); ok {
+			for _, item := range object.Items {
+				if itemKey, err := convert.ObjectKey(item.KeyExpr, src); err == nil && itemKey == key {
+					return querySource{rng: item.ValueExpr.Range(), expr: item.ValueExpr}
+				}
+			}
+		}
+	}
+	return querySource{rng: s.rng}
+}
+
+// element returns the source of the i-th element of the array converted from s
+func (s querySource) element(i int) querySource {
+	switch {
+	case i < len(s.blocks):
+		return querySource{rng: s.blocks[i].Range(), blocks: s.blocks[i : i+1], depth: s.depth}
+	case s.expr != nil:
+		if tuple, ok := s.expr.(*hclsyntax.TupleConsExpr); ok && i < len(tuple.Exprs) {
+			return querySource{rng: tuple.Exprs[i].Range(), expr: tuple.Exprs[i]}
+		}
+	}
+	return querySource{rng: s.rng}
+}
+
+// querySegment is one step of a query path
+type querySegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseQueryPath parses paths like `resource.aws_instance.*.ami` or `variable.region[0].default`.
+// Keys that aren't identifiers can be quoted: `locals[0]."my key"` or `tags["kubernetes.io/name"]`.
+func parseQueryPath(path string) ([]querySegment, error) {
+	var segments []querySegment
+	path = strings.TrimSpace(path)
+	if path == "" || path == "." {
+		return segments, nil
+	}
+
+	i := 0
+	expectKey := true
+	for i < len(path) {
+		switch {
+		case path[i] == '.':
+			i++
+			expectKey = true
+		case path[i] == '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid query path %q: unclosed [", path)
+			}
+			inner := strings.TrimSpace(path[i+1 : i+end])
+			i += end + 1
+			switch {
+			case inner == "*":
+				segments = append(segments, querySegment{wildcard: true})
+			case strings.HasPrefix(inner, `"`):
+				key, err := strconv.Unquote(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid query path %q: %s", path, err)
+				}
+				segments = append(segments, querySegment{key: key})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid query path %q: bad index %q", path, inner)
+				}
+				segments = append(segments, querySegment{index: index, isIndex: true})
+			}
+			expectKey = false
+		case !expectKey:
+			return nil, fmt.Errorf("invalid query path %q: expected . or [ at offset %d", path, i)
+		case path[i] == '"':
+			end := i + 1
+			for end < len(path) && (path[end] != '"' || path[end-1] == '\\') {
+				end++
+			}
+			if end >= len(path) {
+				return nil, fmt.Errorf("invalid query path %q: unclosed quote", path)
+			}
+			key, err := strconv.Unquote(path[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid query path %q: %s", path, err)
+			}
+			segments = append(segments, querySegment{key: key})
+			i = end + 1
+			expectKey = false
+		default:
+			end := i
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			key := path[i:end]
+			if key == "*" {
+				segments = append(segments, querySegment{wildcard: true})
+			} else {
+				segments = append(segments, querySegment{key: key})
+			}
+			i = end
+			expectKey = false
+		}
+	}
+
+	return segments, nil
+}
+
+// query returns the nodes matching path. Looking up a key on a list applies the
+// lookup to every element, so single block bodies don't need an explicit [0].
+func (n *queryNode) query(path []querySegment) []*queryNode {
+	matches := []*queryNode{n}
+	for _, segment := range path {
+		var next []*queryNode
+		for _, match := range matches {
+			next = append(next, match.step(segment)...)
+		}
+		matches = next
+	}
+	return matches
+}
+
+func (n *queryNode) step(segment querySegment) []*queryNode {
+	switch {
+	case segment.wildcard:
+		if n.isObject() {
+			var children []*queryNode
+			for _, key := range n.keys {
+				children = append(children, n.members[key])
+			}
+			return children
+		}
+		return n.elements
+	case segment.isIndex:
+		index := segment.index
+		if index < 0 {
+			index += len(n.elements)
+		}
+		if !n.isList || index < 0 || index >= len(n.elements) {
+			return nil
+		}
+		return []*queryNode{n.elements[index]}
+	case n.isObject():
+		if child, ok := n.members[segment.key]; ok {
+			return []*queryNode{child}
+		}
+		return nil
+	case n.isList:
+		var children []*queryNode
+		for _, elem := range n.elements {
+			children = append(children, elem.step(segment)...)
+		}
+		return children
+	default:
+		return nil
+	}
+}
+
+// render formats a match in the requested output format
+func (n *queryNode) render(format string, src []byte) (string, error) {
+	switch format {
+	case "json":
+		out, err := json.MarshalIndent(n.value, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	case "hcl":
+		return string(n.rng.SliceBytes(src)), nil
+	case "location":
+		return n.rng.String(), nil
+	default:
+		return "", fmt.Errorf("unknown query format %q, expected json, hcl or location", format)
+	}
+}
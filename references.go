@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/hashicorp/hcl/v2/hclwrite"
+
+	"github.com/kvz/json2hcl/convert"
+)
+
+// bareReferences rewrites the meta-arguments of body, a blockType block, and its nested
+// blocks that Terraform JSON writes as plain strings, like depends_on = ["aws_s3_bucket.logs"]
+// or provider = "aws.west", to the bare references native syntax requires
+func bareReferences(body *hclwrite.Body, blockType string) {
+	for name, attr := range body.Attributes() {
+		if !convert.IsReferenceAttribute(name, blockType) {
+			continue
+		}
+		tokens := attr.Expr().BuildTokens(nil)
+		unquoted := unquoteReferenceTokens(name, tokens, func(from, to string) {})
+		if !tokensEqual(unquoted, tokens) {
+			body.SetAttributeRaw(name, unquoted)
+		}
+	}
+
+	for _, block := range body.Blocks() {
+		bareReferences(block.Body(), block.Type())
+	}
+}
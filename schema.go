@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// jsonSchemaDialect is the JSON Schema version the schema command emits
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// runSchema implements the `schema` command
+func runSchema(args []string) error {
+	flags := flag.NewFlagSet("schema", flag.ExitOnError)
+	title := flags.String("title", "", "Title of the generated schema")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: json2hcl schema [-title name] <module dir or .tf file>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("schema requires at least one module directory or file")
+	}
+
+	variables, err := loadModuleVariables(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	schema := variablesSchema(variables)
+	if *title != "" {
+		schema["title"] = *title
+	}
+
+	out, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+type jsonSchema = map[string]interface{}
+
+// variablesSchema describes the input variables of a module as a JSON Schema object
+func variablesSchema(variables []*variableDecl) jsonSchema {
+	properties := make(jsonSchema)
+	required := []string{}
+
+	for _, variable := range variables {
+		property := typeSchema(variable.Type, variable.TypeDefaults)
+		for _, validation := range variable.Validations {
+			conditionSchema(validation.Condition, variable.Name, property)
+		}
+
+		if variable.Description != "" {
+			property["description"] = variable.Description
+		}
+		if variable.HasDefault && variable.Default != cty.NilVal {
+			property["default"] = ctyjson.SimpleJSONValue{Value: variable.Default}
+		}
+		if variable.Sensitive {
+			property["writeOnly"] = true
+		}
+		if variable.Nullable && !variable.Type.Equals(cty.DynamicPseudoType) {
+			property = nullableSchema(property)
+		}
+
+		properties[variable.Name] = property
+		if variable.Required() {
+			required = append(required, variable.Name)
+		}
+	}
+
+	sort.Strings(required)
+	return jsonSchema{
+		"$schema":              jsonSchemaDialect,
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema maps a Terraform type constraint onto JSON Schema
+func typeSchema(ty cty.Type, defaults *typeexpr.Defaults) jsonSchema {
+	child := func(key string) *typeexpr.Defaults {
+		if defaults == nil {
+			return nil
+		}
+		return defaults.Children[key]
+	}
+
+	switch {
+	case ty.Equals(cty.String):
+		return jsonSchema{"type": "string"}
+	case ty.Equals(cty.Number):
+		return jsonSchema{"type": "number"}
+	case ty.Equals(cty.Bool):
+		return jsonSchema{"type": "boolean"}
+	case ty.IsListType():
+		return jsonSchema{"type": "array", "items": typeSchema(ty.ElementType(), child(""))}
+	case ty.IsSetType():
+		return jsonSchema{"type": "array", "items": typeSchema(ty.ElementType(), child("")), "uniqueItems": true}
+	case ty.IsMapType():
+		return jsonSchema{"type": "object", "additionalProperties": typeSchema(ty.ElementType(), child(""))}
+	case ty.IsTupleType():
+		items := []interface{}{}
+		for i, elem := range ty.TupleElementTypes() {
+			items = append(items, typeSchema(elem, child(strconv.Itoa(i))))
+		}
+		return jsonSchema{
+			"type":        "array",
+			"prefixItems": items,
+			"items":       false,
+			"minItems":    len(items),
+		}
+	case ty.IsObjectType():
+		properties := make(jsonSchema)
+		required := []string{}
+		for name, attr := range ty.AttributeTypes() {
+			property := typeSchema(attr, child(name))
+			if defaults != nil {
+				if val, ok := defaults.DefaultValues[name]; ok {
+					property["default"] = ctyjson.SimpleJSONValue{Value: val}
+				}
+			}
+			properties[name] = property
+			if !ty.AttributeOptional(name) {
+				required = append(required, name)
+			}
+		}
+		sort.Strings(required)
+		return jsonSchema{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		// any accepts every value
+		return jsonSchema{}
+	}
+}
+
+// nullableSchema additionally allows null
+func nullableSchema(schema jsonSchema) jsonSchema {
+	if typeName, ok := schema["type"].(string); ok {
+		schema["type"] = []string{typeName, "null"}
+		return schema
+	}
+	return jsonSchema{"anyOf": []interface{}{schema, jsonSchema{"type": "null"}}}
+}
+
+// conditionSchema maps simple validation conditions onto schema keywords. Supported are
+// can(regex(...)), contains([...], var.x), comparisons of var.x or length(var.x) against
+// numbers, and && combinations of those. Other conditions are left out of the schema.
+func conditionSchema(condition hcl.Expression, name string, schema jsonSchema) {
+	switch expr := condition.(type) {
+	case *hclsyntax.ParenthesesExpr:
+		conditionSchema(expr.Expression, name, schema)
+	case *hclsyntax.BinaryOpExpr:
+		if expr.Op == hclsyntax.OpLogicalAnd {
+			conditionSchema(expr.LHS, name, schema)
+			conditionSchema(expr.RHS, name, schema)
+			return
+		}
+		comparisonSchema(expr, name, schema)
+	case *hclsyntax.FunctionCallExpr:
+		switch {
+		case expr.Name == "can" && len(expr.Args) == 1:
+			if call, ok := expr.Args[0].(*hclsyntax.FunctionCallExpr); ok && call.Name == "regex" && len(call.Args) == 2 {
+				if pattern, ok := literalString(call.Args[0]); ok && isVariableRef(call.Args[1], name) {
+					schema["pattern"] = pattern
+				}
+			}
+		case expr.Name == "contains" && len(expr.Args) == 2 && isVariableRef(expr.Args[1], name):
+			if val, diags := expr.Args[0].Value(nil); !diags.HasErrors() && val.IsWhollyKnown() && val.CanIterateElements() {
+				enum := []interface{}{}
+				for it := val.ElementIterator(); it.Next(); {
+					_, elem := it.Element()
+					enum = append(enum, ctyjson.SimpleJSONValue{Value: elem})
+				}
+				schema["enum"] = enum
+			}
+		}
+	}
+}
+
+// comparisonSchema maps `var.x >= 1` or `length(var.x) <= 10` onto min/max keywords
+func comparisonSchema(expr *hclsyntax.BinaryOpExpr, name string, schema jsonSchema) {
+	lhs, rhs, op := expr.LHS, expr.RHS, expr.Op
+	if _, ok := literalNumber(lhs); ok {
+		// Normalise `1 <= var.x` to `var.x >= 1`
+		lhs, rhs = rhs, lhs
+		switch op {
+		case hclsyntax.OpGreaterThan:
+			op = hclsyntax.OpLessThan
+		case hclsyntax.OpGreaterThanOrEqual:
+			op = hclsyntax.OpLessThanOrEqual
+		case hclsyntax.OpLessThan:
+			op = hclsyntax.OpGreaterThan
+		case hclsyntax.OpLessThanOrEqual:
+			op = hclsyntax.OpGreaterThanOrEqual
+		}
+	}
+
+	bound, ok := literalNumber(rhs)
+	if !ok {
+		return
+	}
+
+	var keywords map[*hclsyntax.Operation]string
+	if isVariableRef(lhs, name) {
+		keywords = map[*hclsyntax.Operation]string{
+			hclsyntax.OpGreaterThan:        "exclusiveMinimum",
+			hclsyntax.OpGreaterThanOrEqual: "minimum",
+			hclsyntax.OpLessThan:           "exclusiveMaximum",
+			hclsyntax.OpLessThanOrEqual:    "maximum",
+		}
+	} else if call, isCall := lhs.(*hclsyntax.FunctionCallExpr); isCall && call.Name == "length" && len(call.Args) == 1 && isVariableRef(call.Args[0], name) {
+		prefix := "Length"
+		switch schema["type"] {
+		case "array":
+			prefix = "Items"
+		case "object":
+			prefix = "Properties"
+		}
+
+		// Lengths are integers, so strict bounds become inclusive ones
+		integer, _ := bound.Int(nil)
+		keywords = map[*hclsyntax.Operation]string{
+			hclsyntax.OpGreaterThanOrEqual: "min" + prefix,
+			hclsyntax.OpLessThanOrEqual:    "max" + prefix,
+		}
+		switch op {
+		case hclsyntax.OpGreaterThan:
+			op, integer = hclsyntax.OpGreaterThanOrEqual, integer.Add(integer, big.NewInt(1))
+		case hclsyntax.OpLessThan:
+			op, integer = hclsyntax.OpLessThanOrEqual, integer.Sub(integer, big.NewInt(1))
+		}
+		if keyword, ok := keywords[op]; ok {
+			schema[keyword] = integer
+		}
+		return
+	}
+
+	if keyword, ok := keywords[op]; ok {
+		schema[keyword] = json.Number(bound.Text('g', -1))
+	}
+}
+
+// isVariableRef reports whether expr is exactly var.<name>
+func isVariableRef(expr hcl.Expression, name string) bool {
+	traversal, ok := expr.(*hclsyntax.ScopeTraversalExpr)
+	if !ok || len(traversal.Traversal) != 2 || traversal.Traversal.RootName() != "var" {
+		return false
+	}
+	attr, ok := traversal.Traversal[1].(hcl.TraverseAttr)
+	return ok && attr.Name == name
+}
+
+// literalString returns the value of a constant string expression
+func literalString(expr hcl.Expression) (string, bool) {
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || !val.IsKnown() || val.IsNull() || !val.Type().Equals(cty.String) {
+		return "", false
+	}
+	return val.AsString(), true
+}
+
+// literalNumber returns the value of a constant number expression
+func literalNumber(expr hcl.Expression) (*big.Float, bool) {
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || !val.IsKnown() || val.IsNull() || !val.Type().Equals(cty.Number) {
+		return nil, false
+	}
+	return val.AsBigFloat(), true
+}
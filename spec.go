@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kvz/json2hcl/convert"
+	"github.com/zclconf/go-cty/cty"
+	ctyconvert "github.com/zclconf/go-cty/cty/convert"
+)
+
+// bodySpec is the body structure of the hcldec spec given with -spec. When set, it decides
+// which JSON keys are blocks and how many labels they take, instead of the Terraform rules.
+var bodySpec *convert.Spec
+
+// specBlockTypes are the block types of the hcldec spec format
+var specBlockTypes = []string{
+	"array",
+	"attr",
+	"block",
+	"block_attrs",
+	"block_list",
+	"block_map",
+	"block_set",
+	"default",
+	"literal",
+	"object",
+	"transform",
+}
+
+// specSchema returns the schema of a body holding spec blocks, labelled inside object specs
+func specSchema(labelled bool) *hcl.BodySchema {
+	schema := &hcl.BodySchema{}
+	for _, name := range specBlockTypes {
+		header := hcl.BlockHeaderSchema{Type: name}
+		if labelled {
+			header.LabelNames = []string{"key"}
+		}
+		schema.Blocks = append(schema.Blocks, header)
+	}
+	return schema
+}
+
+// loadSpec reads an hcldec spec file, see
+// https://github.com/hashicorp/hcl/blob/main/cmd/hcldec/spec-format.md.
+// The variables and function blocks of the format are accepted but not used.
+func loadSpec(filename string) (hcldec.Spec, error) {
+	file, diags := hclparse.NewParser().ParseHCLFile(filename)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to parse spec: %s", diags.Error())
+	}
+
+	schema := specSchema(false)
+	schema.Blocks = append(schema.Blocks,
+		hcl.BlockHeaderSchema{Type: "variables"},
+		hcl.BlockHeaderSchema{Type: "function", LabelNames: []string{"name"}},
+	)
+	content, diags := file.Body.Content(schema)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to read spec: %s", diags.Error())
+	}
+
+	var root *hcl.Block
+	for _, block := range content.Blocks {
+		if block.Type == "variables" || block.Type == "function" {
+			continue
+		}
+		if root != nil {
+			return nil, fmt.Errorf("unable to read spec: %s: a spec file must have exactly one root spec block", block.DefRange)
+		}
+		root = block
+	}
+	if root == nil {
+		return nil, fmt.Errorf("unable to read spec: a spec file must have exactly one root spec block")
+	}
+
+	spec, diags := decodeSpecBlock(root)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to read spec: %s", diags.Error())
+	}
+	return spec, nil
+}
+
+// decodeSpecBlock decodes a single spec block
+func decodeSpecBlock(block *hcl.Block) (hcldec.Spec, hcl.Diagnostics) {
+	var impliedName string
+	if len(block.Labels) > 0 {
+		impliedName = block.Labels[0]
+	}
+
+	switch block.Type {
+	case "object":
+		content, diags := block.Body.Content(specSchema(true))
+		spec := make(hcldec.ObjectSpec)
+		for _, nested := range content.Blocks {
+			nestedSpec, nestedDiags := decodeSpecBlock(nested)
+			diags = append(diags, nestedDiags...)
+			spec[nested.Labels[0]] = nestedSpec
+		}
+		return spec, diags
+
+	case "array":
+		content, diags := block.Body.Content(specSchema(false))
+		spec := make(hcldec.TupleSpec, 0, len(content.Blocks))
+		for _, nested := range content.Blocks {
+			nestedSpec, nestedDiags := decodeSpecBlock(nested)
+			diags = append(diags, nestedDiags...)
+			spec = append(spec, nestedSpec)
+		}
+		return spec, diags
+
+	case "attr":
+		content, diags := block.Body.Content(&hcl.BodySchema{Attributes: []hcl.AttributeSchema{
+			{Name: "name"}, {Name: "type"}, {Name: "required"},
+		}})
+		spec := &hcldec.AttrSpec{Name: impliedName, Type: cty.DynamicPseudoType}
+		diags = append(diags, decodeSpecArgument(content, "name", &spec.Name)...)
+		diags = append(diags, decodeSpecArgument(content, "required", &spec.Required)...)
+		if attr, ok := content.Attributes["type"]; ok {
+			ty, typeDiags := typeexpr.TypeConstraint(attr.Expr)
+			diags = append(diags, typeDiags...)
+			spec.Type = ty
+		}
+		return spec, diags
+
+	case "block", "block_list", "block_set", "block_map":
+		content, diags := block.Body.Content(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{
+				{Name: "block_type"}, {Name: "required"}, {Name: "min_items"}, {Name: "max_items"}, {Name: "labels"},
+			},
+			Blocks: specSchema(false).Blocks,
+		})
+		typeName := impliedName
+		diags = append(diags, decodeSpecArgument(content, "block_type", &typeName)...)
+		if typeName == "" {
+			diags = append(diags, specError(block, "missing block_type in %s spec", block.Type))
+		}
+		if len(content.Blocks) != 1 {
+			return nil, append(diags, specError(block, "a %s spec must have exactly one nested spec", block.Type))
+		}
+		nested, nestedDiags := decodeSpecBlock(content.Blocks[0])
+		diags = append(diags, nestedDiags...)
+
+		switch block.Type {
+		case "block":
+			spec := &hcldec.BlockSpec{TypeName: typeName, Nested: nested}
+			diags = append(diags, decodeSpecArgument(content, "required", &spec.Required)...)
+			return spec, diags
+		case "block_list":
+			spec := &hcldec.BlockListSpec{TypeName: typeName, Nested: nested}
+			diags = append(diags, decodeSpecArgument(content, "min_items", &spec.MinItems)...)
+			diags = append(diags, decodeSpecArgument(content, "max_items", &spec.MaxItems)...)
+			return spec, diags
+		case "block_set":
+			spec := &hcldec.BlockSetSpec{TypeName: typeName, Nested: nested}
+			diags = append(diags, decodeSpecArgument(content, "min_items", &spec.MinItems)...)
+			diags = append(diags, decodeSpecArgument(content, "max_items", &spec.MaxItems)...)
+			return spec, diags
+		default:
+			spec := &hcldec.BlockMapSpec{TypeName: typeName, Nested: nested}
+			diags = append(diags, decodeSpecArgument(content, "labels", &spec.LabelNames)...)
+			if len(spec.LabelNames) == 0 {
+				diags = append(diags, specError(block, "a block_map spec must have at least one label"))
+			}
+			return spec, diags
+		}
+
+	case "block_attrs":
+		content, diags := block.Body.Content(&hcl.BodySchema{Attributes: []hcl.AttributeSchema{
+			{Name: "block_type"}, {Name: "element_type", Required: true}, {Name: "required"},
+		}})
+		spec := &hcldec.BlockAttrsSpec{TypeName: impliedName, ElementType: cty.DynamicPseudoType}
+		diags = append(diags, decodeSpecArgument(content, "block_type", &spec.TypeName)...)
+		diags = append(diags, decodeSpecArgument(content, "required", &spec.Required)...)
+		if attr, ok := content.Attributes["element_type"]; ok {
+			ty, typeDiags := typeexpr.TypeConstraint(attr.Expr)
+			diags = append(diags, typeDiags...)
+			spec.ElementType = ty
+		}
+		if spec.TypeName == "" {
+			diags = append(diags, specError(block, "missing block_type in block_attrs spec"))
+		}
+		return spec, diags
+
+	case "literal":
+		content, diags := block.Body.Content(&hcl.BodySchema{Attributes: []hcl.AttributeSchema{
+			{Name: "value", Required: true},
+		}})
+		spec := &hcldec.LiteralSpec{Value: cty.NullVal(cty.DynamicPseudoType)}
+		diags = append(diags, decodeSpecArgument(content, "value", &spec.Value)...)
+		return spec, diags
+
+	case "default":
+		content, diags := block.Body.Content(specSchema(false))
+		var spec hcldec.Spec
+		for _, nested := range content.Blocks {
+			candidate, nestedDiags := decodeSpecBlock(nested)
+			diags = append(diags, nestedDiags...)
+			if spec == nil {
+				spec = candidate
+			} else {
+				spec = &hcldec.DefaultSpec{Primary: spec, Default: candidate}
+			}
+		}
+		if spec == nil {
+			diags = append(diags, specError(block, "a default spec must have at least one nested spec"))
+		}
+		return spec, diags
+
+	default: // transform
+		content, diags := block.Body.Content(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "result", Required: true}},
+			Blocks:     specSchema(false).Blocks,
+		})
+		if len(content.Blocks) != 1 {
+			return nil, append(diags, specError(block, "a transform spec must have exactly one nested spec"))
+		}
+		nested, nestedDiags := decodeSpecBlock(content.Blocks[0])
+		diags = append(diags, nestedDiags...)
+		spec := &hcldec.TransformExprSpec{Wrapped: nested, VarName: "nested"}
+		if attr, ok := content.Attributes["result"]; ok {
+			spec.Expr = attr.Expr
+		}
+		return spec, diags
+	}
+}
+
+// decodeSpecArgument decodes the named argument of a spec block into target, if it is set
+func decodeSpecArgument(content *hcl.BodyContent, name string, target interface{}) hcl.Diagnostics {
+	attr, ok := content.Attributes[name]
+	if !ok {
+		return nil
+	}
+	return gohcl.DecodeExpression(attr.Expr, nil, target)
+}
+
+// specError returns an error diagnostic about a spec block
+func specError(block *hcl.Block, format string, args ...interface{}) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid spec",
+		Detail:   fmt.Sprintf(format, args...),
+		Subject:  block.DefRange.Ptr(),
+	}
+}
+
+// convertSpecBody converts the content of an HCL JSON body described by spec. Keys the spec
+// doesn't know are written as attributes.
+func convertSpecBody(content map[string]cty.Value, spec *convert.Spec, nativeBody *hclwrite.Body) error {
+	for _, name := range sortedValueKeys(content) {
+		val := content[name]
+
+		if block := spec.Block(name); block != nil {
+			instances, err := specBlockInstances(nil, block.Labels, val)
+			if err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+			explainDecision(nativeBody, name, blockBecause(reasonSpec, fmt.Sprintf("%s is a block type of the spec with %d labels", name, block.Labels)))
+			for _, instance := range instances {
+				if err := checkBodyKeys(instance.content, name, instance.labels); err != nil {
+					return err
+				}
+				nativeBlock := appendBlock(nativeBody, name, instance.labels)
+				if err := convertSpecBody(instance.content, block.Body, nativeBlock.Body()); err != nil {
+					return fmt.Errorf("%s: %s", name, err)
+				}
+			}
+			continue
+		}
+
+		if ty := spec.AttributeType(name); ty != cty.NilType {
+			explainDecision(nativeBody, name, attributeBecause(reasonSpec, fmt.Sprintf("%s is an attribute of the spec of type %s", name, ty.FriendlyName())))
+		} else {
+			explainDecision(nativeBody, name, attributeBecause(reasonSpec, name+" isn't a block type of the spec"))
+		}
+		setAttributeWithExpressionHandling(nativeBody, name, specTypedValue(val, spec.AttributeType(name)))
+	}
+	return nil
+}
+
+// specBlockInstances returns the blocks held by the value of a block type key that takes
+// the given number of labels. Every label level may be an object or an array of objects.
+func specBlockInstances(labels []string, remaining int, val cty.Value) ([]jsonBlockInstance, error) {
+	if val.IsNull() || !val.IsKnown() {
+		return nil, fmt.Errorf("expected an object or an array of objects")
+	}
+
+	ty := val.Type()
+	if ty.IsListType() || ty.IsTupleType() {
+		var instances []jsonBlockInstance
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			elemInstances, err := specBlockInstances(labels, remaining, elem)
+			if err != nil {
+				return nil, err
+			}
+			instances = append(instances, elemInstances...)
+		}
+		return instances, nil
+	}
+	if !ty.IsObjectType() {
+		return nil, fmt.Errorf("expected an object or an array of objects")
+	}
+
+	content := val.AsValueMap()
+	if remaining == 0 {
+		if content == nil {
+			content = map[string]cty.Value{}
+		}
+		return []jsonBlockInstance{{labels: labels, content: content}}, nil
+	}
+
+	var instances []jsonBlockInstance
+	for _, label := range sortedValueKeys(content) {
+		nestedLabels := append(append([]string{}, labels...), label)
+		labelInstances, err := specBlockInstances(nestedLabels, remaining-1, content[label])
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, labelInstances...)
+	}
+	return instances, nil
+}
+
+// specTypedValue converts a JSON value to the type the spec gives its attribute, if it is
+// known and the value converts. Strings with interpolations are expressions and kept as is.
+func specTypedValue(val cty.Value, ty cty.Type) cty.Value {
+	if ty == cty.NilType || ty == cty.DynamicPseudoType {
+		return val
+	}
+	if val.Type() == cty.String && !val.IsNull() && strings.Contains(val.AsString(), "${") {
+		return val
+	}
+	if val.Type().Equals(ty) {
+		// Keeps the text of numbers
+		return val
+	}
+	unmarked, _ := val.UnmarkDeep()
+	converted, err := ctyconvert.Convert(unmarked, ty)
+	if err != nil {
+		return val
+	}
+	return converted
+}
+
+// specJSONToNativeFile converts HCL JSON to native syntax as bodySpec describes it
+func specJSONToNativeFile(input []byte, filename string) (*hclwrite.File, error) {
+	file, diags := hclparse.NewParser().ParseJSON(input, filename)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to parse JSON: %s", diags.Error())
+	}
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to parse JSON: %s", diags.Error())
+	}
+
+	literals, err := decodeJSON(input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON: %s", err)
+	}
+	topLevel, _ := literals.(map[string]interface{})
+
+	content := make(map[string]cty.Value, len(attrs))
+	for name, attr := range attrs {
+		val, valDiags := attr.Expr.Value(nil)
+		if valDiags.HasErrors() {
+			return nil, fmt.Errorf("unable to read %s: %s", name, valDiags.Error())
+		}
+		content[name] = withNumberLiterals(val, topLevel[name])
+	}
+
+	if err := checkBodyKeys(content, "", nil); err != nil {
+		return nil, err
+	}
+
+	nativeFile := hclwrite.NewEmptyFile()
+	if err := convertSpecBody(content, bodySpec, nativeFile.Body()); err != nil {
+		return nil, fmt.Errorf("unable to convert to native HCL: %s", err)
+	}
+	return nativeFile, nil
+}
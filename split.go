@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// defaultSplitFile is where blocks end up when no rule matches them
+const defaultSplitFile = "main.tf"
+
+// defaultSplitFiles maps top-level block types to their conventional file
+var defaultSplitFiles = map[string]string{
+	"terraform": "versions.tf",
+	"provider":  "providers.tf",
+	"variable":  "variables.tf",
+	"output":    "outputs.tf",
+	"locals":    "locals.tf",
+	"data":      "data.tf",
+}
+
+// splitRule routes blocks of a type, optionally narrowed by a first label prefix, to a file
+type splitRule struct {
+	blockType   string
+	labelPrefix string
+	filename    string
+}
+
+// parseSplitMap parses a mapping like "resource.aws_iam_=iam.tf,module=modules.tf"
+func parseSplitMap(spec string) ([]splitRule, error) {
+	var rules []splitRule
+	if strings.TrimSpace(spec) == "" {
+		return rules, nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, filename, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(key) == "" || strings.TrimSpace(filename) == "" {
+			return nil, fmt.Errorf("invalid split mapping %q, expected <block type>[.<label prefix>]=<file>", entry)
+		}
+
+		filename = strings.TrimSpace(filename)
+		if filepath.Base(filename) != filename {
+			return nil, fmt.Errorf("invalid split mapping %q, file must not contain a directory", entry)
+		}
+
+		blockType, labelPrefix, _ := strings.Cut(strings.TrimSpace(key), ".")
+		rules = append(rules, splitRule{
+			blockType:   blockType,
+			labelPrefix: labelPrefix,
+			filename:    filename,
+		})
+	}
+
+	return rules, nil
+}
+
+// splitFilename picks the file for a block, preferring the most specific user rule
+func splitFilename(blockType string, labels []string, rules []splitRule) string {
+	var best *splitRule
+	for i, rule := range rules {
+		if rule.blockType != blockType {
+			continue
+		}
+		if rule.labelPrefix != "" && (len(labels) == 0 || !strings.HasPrefix(labels[0], rule.labelPrefix)) {
+			continue
+		}
+		if best == nil || len(rule.labelPrefix) > len(best.labelPrefix) {
+			best = &rules[i]
+		}
+	}
+	if best != nil {
+		return best.filename
+	}
+
+	if filename, ok := defaultSplitFiles[blockType]; ok {
+		return filename
+	}
+	return defaultSplitFile
+}
+
+// splitNativeFile distributes the top-level content of a generated file over per-concern files
+func splitNativeFile(file *hclwrite.File, rules []splitRule) map[string]*hclwrite.File {
+	files := make(map[string]*hclwrite.File)
+	fileFor := func(filename string) *hclwrite.File {
+		if _, exists := files[filename]; !exists {
+			files[filename] = hclwrite.NewEmptyFile()
+		}
+		return files[filename]
+	}
+
+	// Top-level attributes have no block type, keep them together in the default file
+	attrs := file.Body().Attributes()
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		target := fileFor(defaultSplitFile)
+		target.Body().SetAttributeRaw(name, attrs[name].Expr().BuildTokens(nil))
+	}
+
+	for _, block := range file.Body().Blocks() {
+		target := fileFor(splitFilename(block.Type(), block.Labels(), rules))
+		target.Body().AppendBlock(block)
+	}
+
+	return files
+}
+
+// writeSplitFiles writes each generated file into dir, creating it when needed
+func writeSplitFiles(dir string, files map[string]*hclwrite.File) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create output directory: %s", err)
+	}
+
+	for filename, file := range files {
+		path := filepath.Join(dir, filename)
+		if err := os.WriteFile(path, hclwrite.Format(file.Bytes()), 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %s", path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/zclconf/go-cty/cty"
+	ctyconvert "github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// validationFunctions are the functions available to variable validation conditions.
+// Conditions calling anything else are skipped with a warning.
+var validationFunctions = map[string]function.Function{
+	"abs":       stdlib.AbsoluteFunc,
+	"can":       tryfunc.CanFunc,
+	"ceil":      stdlib.CeilFunc,
+	"concat":    stdlib.ConcatFunc,
+	"contains":  stdlib.ContainsFunc,
+	"distinct":  stdlib.DistinctFunc,
+	"flatten":   stdlib.FlattenFunc,
+	"floor":     stdlib.FloorFunc,
+	"format":    stdlib.FormatFunc,
+	"join":      stdlib.JoinFunc,
+	"keys":      stdlib.KeysFunc,
+	"length":    stdlib.LengthFunc,
+	"lookup":    stdlib.LookupFunc,
+	"lower":     stdlib.LowerFunc,
+	"max":       stdlib.MaxFunc,
+	"merge":     stdlib.MergeFunc,
+	"min":       stdlib.MinFunc,
+	"regex":     stdlib.RegexFunc,
+	"regexall":  stdlib.RegexAllFunc,
+	"replace":   stdlib.ReplaceFunc,
+	"split":     stdlib.SplitFunc,
+	"substr":    stdlib.SubstrFunc,
+	"tobool":    stdlib.MakeToFunc(cty.Bool),
+	"tonumber":  stdlib.MakeToFunc(cty.Number),
+	"tostring":  stdlib.MakeToFunc(cty.String),
+	"trimspace": stdlib.TrimSpaceFunc,
+	"try":       tryfunc.TryFunc,
+	"upper":     stdlib.UpperFunc,
+	"values":    stdlib.ValuesFunc,
+}
+
+// checkTFVars type-checks tfvars JSON against variable declarations, converting values
+// to their declared types. It returns the converted JSON, or every problem found.
+func checkTFVars(input []byte, variables []*variableDecl) ([]byte, []string, error) {
+	decoded, err := decodeJSON(input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse JSON: %s", err)
+	}
+	values, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("tfvars must be a JSON object")
+	}
+
+	declared := make(map[string]*variableDecl)
+	for _, variable := range variables {
+		declared[variable.Name] = variable
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	converted := make(map[string]cty.Value)
+	for _, name := range names {
+		variable, ok := declared[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("var.%s: variable is not declared", name))
+			continue
+		}
+
+		val, err := jsonToCty(values[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		if val.IsNull() {
+			if !variable.Nullable {
+				problems = append(problems, fmt.Sprintf("var.%s: must not be null", name))
+			}
+			converted[name] = cty.NullVal(variable.Type)
+			continue
+		}
+
+		if variable.TypeDefaults != nil {
+			val = variable.TypeDefaults.Apply(val)
+		}
+		convertedVal, err := ctyconvert.Convert(val, variable.Type)
+		if err != nil {
+			problems = append(problems, formatPathError("var."+name, conversionError(val, variable.Type, nil)))
+			continue
+		}
+		converted[name] = convertedVal
+	}
+
+	for _, variable := range variables {
+		if _, ok := values[variable.Name]; !ok && variable.Required() {
+			problems = append(problems, fmt.Sprintf("var.%s: required variable is not set", variable.Name))
+		}
+	}
+
+	problems = append(problems, checkValidations(variables, converted)...)
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+
+	out := make(map[string]interface{}, len(values))
+	for name, val := range converted {
+		valJSON, err := ctyjson.Marshal(val, val.Type())
+		if err != nil {
+			return nil, nil, err
+		}
+		decodedVal, err := decodeJSON(valJSON)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Conversion adds optional object attributes as null or their defaults,
+		// only keep what was written in the input
+		out[name] = pruneToShape(decodedVal, values[name])
+	}
+
+	output, err := json.Marshal(out)
+	return output, nil, err
+}
+
+// checkValidations evaluates the validation blocks of every variable that has a value
+func checkValidations(variables []*variableDecl, values map[string]cty.Value) []string {
+	all := make(map[string]cty.Value)
+	for _, variable := range variables {
+		if val, ok := values[variable.Name]; ok {
+			all[variable.Name] = val
+		} else if variable.HasDefault && variable.Default != cty.NilVal {
+			all[variable.Name] = variable.Default
+		} else {
+			all[variable.Name] = cty.UnknownVal(variable.Type)
+		}
+	}
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(all)},
+		Functions: validationFunctions,
+	}
+
+	var problems []string
+	for _, variable := range variables {
+		if _, ok := values[variable.Name]; !ok {
+			continue
+		}
+
+		for _, validation := range variable.Validations {
+			result, diags := validation.Condition.Value(ctx)
+			if diags.HasErrors() {
+				fmt.Fprintf(os.Stderr, "Warning: skipping validation of var.%s: %s\n", variable.Name, diags.Error())
+				continue
+			}
+			result, err := ctyconvert.Convert(result, cty.Bool)
+			if err != nil || !result.IsKnown() || result.IsNull() || result.True() {
+				continue
+			}
+
+			message := "validation condition failed"
+			if validation.ErrorMessage != nil {
+				if val, diags := validation.ErrorMessage.Value(ctx); !diags.HasErrors() && val.Type().Equals(cty.String) && val.IsKnown() && !val.IsNull() {
+					message = val.AsString()
+				}
+			}
+			problems = append(problems, fmt.Sprintf("var.%s: %s", variable.Name, message))
+		}
+	}
+
+	return problems
+}
+
+// conversionError returns the error converting the innermost part of val, at path, that
+// can't be converted to want, with the path to it. Convert only returns path errors for
+// values that are converted element by element, not when the types are incompatible as a
+// whole.
+func conversionError(val cty.Value, want cty.Type, path cty.Path) error {
+	_, err := ctyconvert.Convert(val, want)
+	if err == nil {
+		return nil
+	}
+	var pathErr cty.PathError
+	if errors.As(err, &pathErr) {
+		return path.NewError(pathErr)
+	}
+	if !val.IsKnown() || val.IsNull() {
+		return path.NewError(err)
+	}
+
+	ty := val.Type()
+	switch {
+	case want.IsObjectType() && (ty.IsObjectType() || ty.IsMapType()):
+		names := make([]string, 0, len(want.AttributeTypes()))
+		for name := range want.AttributeTypes() {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var attr cty.Value
+			switch {
+			case ty.IsObjectType() && ty.HasAttribute(name):
+				attr = val.GetAttr(name)
+			case ty.IsMapType() && val.HasIndex(cty.StringVal(name)).True():
+				attr = val.Index(cty.StringVal(name))
+			default:
+				continue
+			}
+			if err := conversionError(attr, want.AttributeType(name), path.GetAttr(name)); err != nil {
+				return err
+			}
+		}
+	case (want.IsListType() || want.IsSetType() || want.IsMapType()) && val.CanIterateElements():
+		for it := val.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			if err := conversionError(elem, want.ElementType(), path.Index(key)); err != nil {
+				return err
+			}
+		}
+	case want.IsTupleType() && (ty.IsTupleType() || ty.IsListType()) && val.LengthInt() == len(want.TupleElementTypes()):
+		for i, elemType := range want.TupleElementTypes() {
+			key := cty.NumberIntVal(int64(i))
+			if err := conversionError(val.Index(key), elemType, path.Index(key)); err != nil {
+				return err
+			}
+		}
+	}
+	return path.NewError(err)
+}
+
+// formatPathError renders a cty conversion error with the path it occurred at
+func formatPathError(root string, err error) string {
+	var pathErr cty.PathError
+	if !errors.As(err, &pathErr) {
+		return fmt.Sprintf("%s: %s", root, err)
+	}
+	return fmt.Sprintf("%s: %s", formatCtyPath(root, pathErr.Path), pathErr.Error())
+}
+
+// formatCtyPath renders a cty path in Terraform's reference syntax
+func formatCtyPath(root string, path cty.Path) string {
+	var builder strings.Builder
+	builder.WriteString(root)
+	for _, step := range path {
+		switch typed := step.(type) {
+		case cty.GetAttrStep:
+			builder.WriteString("." + typed.Name)
+		case cty.IndexStep:
+			if typed.Key.Type().Equals(cty.String) {
+				fmt.Fprintf(&builder, "[%q]", typed.Key.AsString())
+			} else if typed.Key.Type().Equals(cty.Number) {
+				fmt.Fprintf(&builder, "[%s]", typed.Key.AsBigFloat().Text('f', -1))
+			} else {
+				builder.WriteString("[?]")
+			}
+		}
+	}
+	return builder.String()
+}
+
+// pruneToShape drops object attributes from value that are absent in shape, and keeps the
+// original text of numbers
+func pruneToShape(value, shape interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		shapeObj, ok := shape.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		for key, elem := range typed {
+			shapeElem, exists := shapeObj[key]
+			if !exists {
+				delete(typed, key)
+				continue
+			}
+			typed[key] = pruneToShape(elem, shapeElem)
+		}
+		return typed
+	case []interface{}:
+		shapeList, ok := shape.([]interface{})
+		if !ok || len(shapeList) != len(typed) {
+			return value
+		}
+		for i := range typed {
+			typed[i] = pruneToShape(typed[i], shapeList[i])
+		}
+		return typed
+	case json.Number:
+		// Keep the text of numbers the conversion didn't change, such as 1.0 or 1e3
+		if original, ok := shape.(json.Number); ok && sameNumber(typed, original) {
+			return original
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+// checkTFVarsAgainst loads the declarations found at paths and checks input against them
+func checkTFVarsAgainst(input []byte, paths string) ([]byte, error) {
+	variables, err := loadModuleVariables(strings.Split(paths, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	output, problems, err := checkTFVars(input, variables)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("tfvars do not match the variable declarations:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return output, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// runTFVarsTemplate implements the `tfvars` command
+func runTFVarsTemplate(args []string) error {
+	flags := flag.NewFlagSet("tfvars", flag.ExitOnError)
+	format := flags.String("format", "hcl", "Output format: hcl (.tfvars) or json (.tfvars.json)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: json2hcl tfvars [-format hcl|json] <module dir or .tf file>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("tfvars requires at least one module directory or file")
+	}
+
+	variables, err := loadModuleVariables(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "hcl":
+		fmt.Print(string(hclwrite.Format(tfvarsTemplate(variables).Bytes())))
+	case "json":
+		out, err := tfvarsTemplateJSON(variables)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	default:
+		return fmt.Errorf("unknown tfvars format %q, expected hcl or json", *format)
+	}
+
+	return nil
+}
+
+// templateValue returns the default of a variable, or a placeholder matching its type
+func templateValue(variable *variableDecl) cty.Value {
+	if variable.HasDefault && variable.Default != cty.NilVal {
+		return variable.Default
+	}
+	return placeholderValue(variable.Type)
+}
+
+// placeholderValue returns an empty value of the given type
+func placeholderValue(ty cty.Type) cty.Value {
+	switch {
+	case ty.Equals(cty.String):
+		return cty.StringVal("")
+	case ty.Equals(cty.Number):
+		return cty.Zero
+	case ty.Equals(cty.Bool):
+		return cty.False
+	case ty.IsListType(), ty.IsSetType():
+		return cty.EmptyTupleVal
+	case ty.IsMapType():
+		return cty.EmptyObjectVal
+	case ty.IsTupleType():
+		elems := make([]cty.Value, 0, len(ty.TupleElementTypes()))
+		for _, elem := range ty.TupleElementTypes() {
+			elems = append(elems, placeholderValue(elem))
+		}
+		return cty.TupleVal(elems)
+	case ty.IsObjectType():
+		attrs := make(map[string]cty.Value)
+		for name, attr := range ty.AttributeTypes() {
+			// Optional attributes can be left out, so they don't need a placeholder
+			if ty.AttributeOptional(name) {
+				continue
+			}
+			attrs[name] = placeholderValue(attr)
+		}
+		return cty.ObjectVal(attrs)
+	default:
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+}
+
+// tfvarsTemplate renders a .tfvars skeleton with the description of each variable as a comment
+func tfvarsTemplate(variables []*variableDecl) *hclwrite.File {
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+
+	for i, variable := range variables {
+		if i > 0 {
+			body.AppendNewline()
+		}
+
+		if variable.Description != "" {
+			var comment strings.Builder
+			for _, line := range strings.Split(strings.TrimSpace(variable.Description), "\n") {
+				comment.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+			}
+			body.AppendUnstructuredTokens(hclwrite.Tokens{
+				{Type: hclsyntax.TokenComment, Bytes: []byte(comment.String())},
+			})
+		}
+
+		// Defaults are values, so a "${" in them is escaped rather than read as a template
+		body.SetAttributeRaw(variable.Name, valueTokens(templateValue(variable)))
+	}
+
+	return file
+}
+
+// tfvarsTemplateJSON renders a .tfvars.json skeleton
+func tfvarsTemplateJSON(variables []*variableDecl) ([]byte, error) {
+	values := make(map[string]interface{}, len(variables))
+	for _, variable := range variables {
+		values[variable.Name] = ctyjson.SimpleJSONValue{Value: templateValue(variable)}
+	}
+	return json.MarshalIndent(values, "", "  ")
+}
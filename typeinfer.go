@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// inferredType is a Terraform type constraint inferred from JSON values
+type inferredType struct {
+	kind     string // string, number, bool, any, list or object
+	elem     *inferredType
+	attrs    map[string]*inferredType
+	optional map[string]bool
+}
+
+var anyType = &inferredType{kind: "any"}
+
+// inferType infers the type constraint of a decoded JSON value
+func inferType(value interface{}) *inferredType {
+	switch typed := value.(type) {
+	case string:
+		return &inferredType{kind: "string"}
+	case json.Number, float64:
+		return &inferredType{kind: "number"}
+	case bool:
+		return &inferredType{kind: "bool"}
+	case []interface{}:
+		var elem *inferredType
+		for _, item := range typed {
+			if elem == nil {
+				elem = inferType(item)
+			} else {
+				elem = unifyTypes(elem, inferType(item))
+			}
+		}
+		if elem == nil {
+			elem = anyType
+		}
+		return &inferredType{kind: "list", elem: elem}
+	case map[string]interface{}:
+		t := &inferredType{kind: "object", attrs: make(map[string]*inferredType), optional: make(map[string]bool)}
+		for key, item := range typed {
+			t.attrs[key] = inferType(item)
+		}
+		return t
+	default:
+		// null carries no type information
+		return anyType
+	}
+}
+
+// unifyTypes returns a type both a and b conform to. Object attributes that are missing
+// on one side become optional, incompatible types fall back to any.
+func unifyTypes(a, b *inferredType) *inferredType {
+	if a.kind == "any" {
+		return b
+	}
+	if b.kind == "any" {
+		return a
+	}
+	if a.kind != b.kind {
+		return anyType
+	}
+
+	switch a.kind {
+	case "list":
+		return &inferredType{kind: "list", elem: unifyTypes(a.elem, b.elem)}
+	case "object":
+		t := &inferredType{kind: "object", attrs: make(map[string]*inferredType), optional: make(map[string]bool)}
+		for key, attr := range a.attrs {
+			if other, ok := b.attrs[key]; ok {
+				t.attrs[key] = unifyTypes(attr, other)
+				t.optional[key] = a.optional[key] || b.optional[key]
+			} else {
+				t.attrs[key] = attr
+				t.optional[key] = true
+			}
+		}
+		for key, attr := range b.attrs {
+			if _, ok := a.attrs[key]; !ok {
+				t.attrs[key] = attr
+				t.optional[key] = true
+			}
+		}
+		return t
+	default:
+		return a
+	}
+}
+
+// isPrimitive reports whether t is string, number or bool
+func (t *inferredType) isPrimitive() bool {
+	return t.kind == "string" || t.kind == "number" || t.kind == "bool"
+}
+
+// mapElem returns the element type when an object is better described as a map, i.e. when
+// all of its attributes are required and share the same type, which must be primitive
+// unless there are several attributes to compare
+func (t *inferredType) mapElem() (*inferredType, bool) {
+	if t.kind != "object" {
+		return nil, false
+	}
+	if len(t.attrs) == 0 {
+		return anyType, true
+	}
+
+	var elem *inferredType
+	for key, attr := range t.attrs {
+		if t.optional[key] || (elem != nil && elem.String() != attr.String()) {
+			return nil, false
+		}
+		elem = attr
+	}
+	if !elem.isPrimitive() && len(t.attrs) < 2 {
+		return nil, false
+	}
+	return elem, true
+}
+
+// unifiedAttrs returns a type all the attributes of the object t conform to
+func (t *inferredType) unifiedAttrs(keys []string) *inferredType {
+	elem := anyType
+	for _, key := range keys {
+		elem = unifyTypes(elem, t.attrs[key])
+	}
+	return elem
+}
+
+// String renders the type constraint in Terraform syntax
+func (t *inferredType) String() string {
+	switch t.kind {
+	case "list":
+		return "list(" + t.elem.String() + ")"
+	case "object":
+		if elem, ok := t.mapElem(); ok {
+			return "map(" + elem.String() + ")"
+		}
+
+		keys := make([]string, 0, len(t.attrs))
+		for key := range t.attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		// Object type attributes must be identifiers, other keys only fit in a map
+		for _, key := range keys {
+			if !hclsyntax.ValidIdentifier(key) {
+				return "map(" + t.unifiedAttrs(keys).String() + ")"
+			}
+		}
+
+		var builder strings.Builder
+		builder.WriteString("object({\n")
+		for _, key := range keys {
+			attrType := t.attrs[key].String()
+			if t.optional[key] {
+				attrType = "optional(" + attrType + ")"
+			}
+			fmt.Fprintf(&builder, "%s = %s\n", key, attrType)
+		}
+		builder.WriteString("})")
+		return builder.String()
+	default:
+		return t.kind
+	}
+}
+
+// variableDeclarations generates variable blocks for every top-level key of a tfvars JSON document
+func variableDeclarations(input []byte, withDefaults bool, descriptions map[string]string) (*hclwrite.File, error) {
+	decoded, err := decodeJSON(input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse JSON: %s", err)
+	}
+	values, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("variables can only be inferred from a JSON object")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	file := hclwrite.NewEmptyFile()
+	for i, name := range names {
+		if i > 0 {
+			file.Body().AppendNewline()
+		}
+		block := file.Body().AppendNewBlock("variable", []string{name})
+
+		if description, ok := descriptions[name]; ok {
+			setAttributeWithExpressionHandling(block.Body(), "description", cty.StringVal(description))
+		}
+
+		typeTokens, err := expressionTokens(inferType(values[name]).String())
+		if err != nil {
+			return nil, err
+		}
+		block.Body().SetAttributeRaw("type", typeTokens)
+
+		if withDefaults {
+			val, err := jsonToCty(values[name])
+			if err != nil {
+				return nil, err
+			}
+			setAttributeWithExpressionHandling(block.Body(), "default", withNumberLiterals(val, values[name]))
+		}
+	}
+
+	return file, nil
+}
+
+// expressionTokens parses an expression written in native syntax into hclwrite tokens
+func expressionTokens(expr string) (hclwrite.Tokens, error) {
+	file, diags := hclwrite.ParseConfig([]byte("expr = "+expr+"\n"), "<expr>", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid expression %q: %s", expr, diags.Error())
+	}
+	return file.Body().GetAttribute("expr").Expr().BuildTokens(nil), nil
+}
+
+// writeVariableDeclarations writes the inferred variable blocks to path
+func writeVariableDeclarations(path string, input []byte, withDefaults bool, descriptionsFile string) error {
+	descriptions := make(map[string]string)
+	if descriptionsFile != "" {
+		data, err := os.ReadFile(descriptionsFile)
+		if err != nil {
+			return fmt.Errorf("unable to read descriptions: %s", err)
+		}
+		if err := json.Unmarshal(data, &descriptions); err != nil {
+			return fmt.Errorf("unable to parse descriptions, expected an object of strings: %s", err)
+		}
+	}
+
+	file, err := variableDeclarations(input, withDefaults, descriptions)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, hclwrite.Format(file.Bytes()), 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+
+	"github.com/kvz/json2hcl/convert"
+)
+
+// upgradeChange is a rewrite of the upgrade command
+type upgradeChange struct {
+	path string
+	rule string
+	from string
+	to   string
+}
+
+func (c upgradeChange) String() string {
+	return fmt.Sprintf("%s: %s: %s -> %s", c.path, c.rule, c.from, c.to)
+}
+
+// runUpgrade implements the `upgrade` command
+func runUpgrade(args []string) error {
+	flags := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	write := flags.Bool("write", true, "Write upgraded files in place, -write=false only reports the changes")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: json2hcl upgrade [-write=false] [file.tf|dir...] (stdin to stdout without files)")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("unable to read from stdin: %s", err)
+		}
+		upgraded, changes, err := upgradeHCL(src, "<stdin>")
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			fmt.Fprintf(os.Stderr, "<stdin>: %s\n", change)
+		}
+		fmt.Print(string(upgraded))
+		return nil
+	}
+
+	filenames, err := fmtFiles(flags.Args())
+	if err != nil {
+		return fmt.Errorf("unable to list files: %s", err)
+	}
+
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %s", filename, err)
+		}
+		upgraded, changes, err := upgradeHCL(src, filename)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, change)
+		}
+		if len(changes) == 0 || !*write {
+			continue
+		}
+		if err := os.WriteFile(filename, upgraded, 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %s", filename, err)
+		}
+	}
+	return nil
+}
+
+// upgradeHCL rewrites the pre-0.12 idioms of a native syntax file: interpolation-only
+// templates, quoted type constraints and quoted references
+func upgradeHCL(src []byte, filename string) ([]byte, []upgradeChange, error) {
+	file, diags := hclwrite.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, nil, fmt.Errorf("unable to parse %s: %s", filename, diags.Error())
+	}
+
+	var changes []upgradeChange
+	upgradeBody(file.Body(), "", "", &changes)
+	return file.Bytes(), changes, nil
+}
+
+// upgradeBody upgrades the attributes of body, a block of blockType at path, and its nested
+// blocks
+func upgradeBody(body *hclwrite.Body, path, blockType string, changes *[]upgradeChange) {
+	attrs := body.Attributes()
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		attrPath := jsonPathKey(path, name)
+		original := attrs[name].Expr().BuildTokens(nil)
+
+		tokens := unwrapTemplateTokens(original, func(from, to string) {
+			*changes = append(*changes, upgradeChange{attrPath, "interpolation-only template", from, to})
+		})
+		if blockType == "variable" && name == "type" {
+			tokens = unquoteTypeTokens(tokens, func(from, to string) {
+				*changes = append(*changes, upgradeChange{attrPath, "quoted type constraint", from, to})
+			})
+		}
+		if convert.IsReferenceAttribute(name, blockType) {
+			tokens = unquoteReferenceTokens(name, tokens, func(from, to string) {
+				*changes = append(*changes, upgradeChange{attrPath, "quoted reference", from, to})
+			})
+		}
+
+		if !tokensEqual(tokens, original) {
+			body.SetAttributeRaw(name, tokens)
+		}
+	}
+
+	for _, block := range body.Blocks() {
+		blockPath := jsonPathKey(path, block.Type())
+		for _, label := range block.Labels() {
+			blockPath = jsonPathKey(blockPath, label)
+		}
+		upgradeBody(block.Body(), blockPath, block.Type(), changes)
+	}
+}
+
+// unwrapTemplateTokens replaces every quoted template that is a single interpolation, like
+// "${var.x}" or "${list(a, b)}", with the interpolated expression. The expression is put in
+// parentheses when it is part of a larger one, like "${var.a + var.b}" * 2, unless it binds
+// as tightly as the template did.
+func unwrapTemplateTokens(tokens hclwrite.Tokens, report func(from, to string)) hclwrite.Tokens {
+	var unwrapped hclwrite.Tokens
+	for i := 0; i < len(tokens); i++ {
+		end, ok := interpolationOnlyEnd(tokens, i)
+		if !ok {
+			unwrapped = append(unwrapped, tokens[i])
+			continue
+		}
+
+		// Templates nested in the expression are unwrapped too, each reported on its own
+		inner := unwrapTemplateTokens(tokens[i+2:end-1], report)
+		if whole := i == 0 && end == len(tokens)-1; !whole && !isOperand(inner) {
+			inner = append(append(hclwrite.Tokens{
+				{Type: hclsyntax.TokenOParen, Bytes: []byte("(")},
+			}, inner...), &hclwrite.Token{Type: hclsyntax.TokenCParen, Bytes: []byte(")")})
+		}
+		report(tokensText(tokens[i:end+1]), tokensText(inner))
+		if len(inner) > 0 {
+			first := *inner[0]
+			first.SpacesBefore = tokens[i].SpacesBefore
+			inner = append(hclwrite.Tokens{&first}, inner[1:]...)
+		}
+		unwrapped = append(unwrapped, inner...)
+		i = end
+	}
+	return unwrapped
+}
+
+// isOperand reports whether tokens are an expression that needs no parentheses as the
+// operand of another one, like a traversal, function call or literal
+func isOperand(tokens hclwrite.Tokens) bool {
+	expr, diags := hclsyntax.ParseExpression(tokens.Bytes(), "<template>", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return false
+	}
+	switch expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr, *hclsyntax.RelativeTraversalExpr, *hclsyntax.FunctionCallExpr,
+		*hclsyntax.LiteralValueExpr, *hclsyntax.TemplateExpr, *hclsyntax.TupleConsExpr,
+		*hclsyntax.ObjectConsExpr, *hclsyntax.ParenthesesExpr:
+		return true
+	default:
+		return false
+	}
+}
+
+// interpolationOnlyEnd returns the position of the closing quote when tokens[start] opens a
+// quoted template made of a single interpolation without strip markers
+func interpolationOnlyEnd(tokens hclwrite.Tokens, start int) (int, bool) {
+	if start+2 >= len(tokens) || tokens[start].Type != hclsyntax.TokenOQuote {
+		return 0, false
+	}
+	if open := tokens[start+1]; open.Type != hclsyntax.TokenTemplateInterp || string(open.Bytes) != "${" {
+		return 0, false
+	}
+
+	depth := 0
+	for i := start + 1; i < len(tokens); i++ {
+		switch tokens[i].Type {
+		case hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			depth++
+		case hclsyntax.TokenTemplateSeqEnd:
+			depth--
+			if depth > 0 {
+				continue
+			}
+			end := i + 1
+			if string(tokens[i].Bytes) != "}" || i == start+2 || end >= len(tokens) || tokens[end].Type != hclsyntax.TokenCQuote {
+				return 0, false
+			}
+			return end, true
+		}
+	}
+	return 0, false
+}
+
+// legacyCollectionTypes maps the bare collection types of Terraform 0.11 to the type
+// constraints Terraform 0.12 reads them as
+var legacyCollectionTypes = map[string]string{
+	"list": "list(any)",
+	"map":  "map(any)",
+	"set":  "set(any)",
+}
+
+// unquoteTypeTokens replaces a quoted type constraint, like "string" or "map", with the
+// bare type expression
+func unquoteTypeTokens(tokens hclwrite.Tokens, report func(from, to string)) hclwrite.Tokens {
+	literal, ok := quotedLiteral(tokens)
+	if !ok {
+		return tokens
+	}
+
+	if collection, ok := legacyCollectionTypes[literal]; ok {
+		literal = collection
+	}
+
+	var typeTokens hclwrite.Tokens
+	if isUnquotedType(literal) {
+		typeTokens = hclwrite.Tokens{{Type: hclsyntax.TokenIdent, Bytes: []byte(literal)}}
+	} else if typeTokens, ok = typeConstraintTokens(literal); !ok {
+		return tokens
+	}
+	report(tokensText(tokens), tokensText(typeTokens))
+	return typeTokens
+}
+
+// unquoteReferenceTokens replaces the quoted references of a reference attribute, like
+// depends_on = ["aws_instance.web"], with bare traversals. ignore_changes = ["*"] becomes all.
+func unquoteReferenceTokens(name string, tokens hclwrite.Tokens, report func(from, to string)) hclwrite.Tokens {
+	if name == "ignore_changes" && tokensText(tokens) == `["*"]` {
+		all := hclwrite.Tokens{{Type: hclsyntax.TokenIdent, Bytes: []byte("all")}}
+		report(tokensText(tokens), "all")
+		return all
+	}
+
+	var unquoted hclwrite.Tokens
+	for i := 0; i < len(tokens); i++ {
+		if i+2 < len(tokens) {
+			if literal, ok := quotedLiteral(tokens[i : i+3]); ok && isTraversal(literal) {
+				report(tokensText(tokens[i:i+3]), literal)
+				unquoted = append(unquoted, &hclwrite.Token{
+					Type:         hclsyntax.TokenIdent,
+					Bytes:        []byte(literal),
+					SpacesBefore: tokens[i].SpacesBefore,
+				})
+				i += 2
+				continue
+			}
+		}
+		unquoted = append(unquoted, tokens[i])
+	}
+	return unquoted
+}
+
+// quotedLiteral returns the text of tokens that are a quoted string without interpolations,
+// with its escapes decoded
+func quotedLiteral(tokens hclwrite.Tokens) (string, bool) {
+	if len(tokens) != 3 || tokens[0].Type != hclsyntax.TokenOQuote || tokens[1].Type != hclsyntax.TokenQuotedLit || tokens[2].Type != hclsyntax.TokenCQuote {
+		return "", false
+	}
+	literal := string(tokens[1].Bytes)
+	if strings.ContainsAny(literal, "$%") {
+		return "", false
+	}
+	if strings.Contains(literal, `\`) {
+		// References like tags["Name"] have escaped quotes
+		unquoted, err := strconv.Unquote(`"` + literal + `"`)
+		if err != nil {
+			return "", false
+		}
+		literal = unquoted
+	}
+	return literal, true
+}
+
+// isTraversal reports whether str is a bare reference like aws_instance.web or module.vpc
+func isTraversal(str string) bool {
+	if strings.ContainsAny(str, " \t\n") {
+		return false
+	}
+	_, diags := hclsyntax.ParseTraversalAbs([]byte(str), "<reference>", hcl.Pos{Line: 1, Column: 1})
+	return !diags.HasErrors()
+}
+
+// tokensText returns the source text of tokens as they are spaced
+func tokensText(tokens hclwrite.Tokens) string {
+	return strings.TrimSpace(string(tokens.Bytes()))
+}